@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+// APIKeyAuthenticator accepts the static keys of our internal services in the X-Api-Key header
+type APIKeyAuthenticator struct {
+	keys []param.APIKeyConfig
+}
+
+func NewAPIKeyAuthenticator(keys []param.APIKeyConfig) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{keys: keys}
+}
+
+func (authenticator *APIKeyAuthenticator) Authenticate(req *http.Request) (*Identity, error) {
+	key := req.Header.Get("X-Api-Key")
+	if key == "" {
+		return nil, nil
+	}
+	for _, apiKey := range authenticator.keys {
+		if apiKey.Key != "" && subtle.ConstantTimeCompare([]byte(apiKey.Key), []byte(key)) == 1 {
+			return &Identity{UserID: apiKey.UserID, Scopes: apiKey.Scopes, Method: "api_key"}, nil
+		}
+	}
+	return nil, ErrUnauthorized
+}
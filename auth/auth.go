@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+var ErrUnauthorized = errors.New("User is not authorized")
+
+// Identity is the caller of a request as set in the gin context by AuthorizeMiddleware
+type Identity struct {
+	UserID int64
+	Scopes []string
+	Method string
+}
+
+func (identity Identity) HasScope(scope string) bool {
+	for _, s := range identity.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type Authenticator interface {
+	// Authenticate returns a nil identity without error when the request carries no credentials for this authenticator
+	Authenticate(req *http.Request) (*Identity, error)
+}
+
+func NewAuthenticators(conf param.AuthConfig) ([]Authenticator, error) {
+	authenticators := []Authenticator{}
+	// the blocks left empty in the config are disabled
+	apiKeys := []param.APIKeyConfig{}
+	for _, apiKey := range conf.APIKeys {
+		if apiKey.Key != "" {
+			apiKeys = append(apiKeys, apiKey)
+		}
+	}
+	if len(apiKeys) > 0 {
+		authenticators = append(authenticators, NewAPIKeyAuthenticator(apiKeys))
+	}
+	if conf.HMAC != nil && conf.HMAC.Secret != "" {
+		authenticator, err := NewHMACAuthenticator(*conf.HMAC)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	if conf.JWT != nil && (conf.JWT.Secret != "" || conf.JWT.JWKSFile != "") {
+		authenticator, err := NewJWTAuthenticator(*conf.JWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	if len(authenticators) == 0 {
+		return nil, errors.New("no authenticator is configured")
+	}
+	return authenticators, nil
+}
+
+// Authenticate runs the authenticators in order, the first one recognising the credentials decides
+func Authenticate(authenticators []Authenticator, req *http.Request) (*Identity, error) {
+	for _, authenticator := range authenticators {
+		identity, err := authenticator.Authenticate(req)
+		if err != nil {
+			return nil, err
+		}
+		if identity != nil {
+			if identity.UserID <= 0 {
+				return nil, ErrUnauthorized
+			}
+			return identity, nil
+		}
+	}
+	return nil, ErrUnauthorized
+}
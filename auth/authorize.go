@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+var ErrForbidden = errors.New("User is not allowed to use this endpoint")
+
+// defaultAdminScope stands for the admin scope of the config in the route scopes
+const defaultAdminScope = "admin"
+
+// defaultRouteScopes are used for routes missing from param.AuthorizationConfig.RouteScopes, the admin routes
+// are listed too so they stay restricted when the config replaces the admin routes
+var defaultRouteScopes = map[string][]string{
+	"GET /balance":                                   {"read"},
+	"GET /wallet/address":                            {"read"},
+	"GET /handshakes":                                {"read"},
+	"GET /handshakes/:chain/:contract/:hid":          {"read"},
+	"GET /allowance":                                 {"read"},
+	"GET /contracts/:contract/:address/call/:method": {"read"},
+	"GET /tx":                  {"tx"},
+	"GET /tx/:hash":            {"tx"},
+	"POST /tx":                 {"tx"},
+	"POST /tx/raw":             {"tx"},
+	"POST /transfer":           {"transfer"},
+	"POST /transfer-token":     {"transfer"},
+	"POST /free-ether":         {"faucet"},
+	"POST /free-token":         {"faucet"},
+	"POST /payable":            {"handshake"},
+	"POST /crowdsale":          {"handshake"},
+	"POST /meta-tx":            {"handshake"},
+	"GET /transfers/batch/:id": {"transfer"},
+	"POST /transfers/batch":    {defaultAdminScope},
+	"POST /contracts/:contract/:address/send/:method": {defaultAdminScope},
+}
+
+// defaultAdminRoutes spend the operator key on arbitrary contracts
+var defaultAdminRoutes = []string{
+	"POST /contracts/:contract/:address/send/:method",
+	"POST /transfers/batch",
+}
+
+func adminScope(conf param.AuthorizationConfig) string {
+	if conf.AdminScope == "" {
+		return defaultAdminScope
+	}
+	return conf.AdminScope
+}
+
+func (identity Identity) IsAdmin(conf param.AuthorizationConfig) bool {
+	return identity.HasScope(adminScope(conf))
+}
+
+// AuthorizeRoute checks the identity has every scope required by the route
+func AuthorizeRoute(conf param.AuthorizationConfig, identity Identity, route string) error {
+	if identity.IsAdmin(conf) {
+		return nil
+	}
+	adminRoutes := conf.AdminRoutes
+	if adminRoutes == nil {
+		adminRoutes = defaultAdminRoutes
+	}
+	for _, adminRoute := range adminRoutes {
+		if adminRoute == route {
+			return ErrForbidden
+		}
+	}
+	scopes, ok := conf.RouteScopes[route]
+	if !ok {
+		scopes = defaultRouteScopes[route]
+	}
+	for _, scope := range scopes {
+		if scope == defaultAdminScope {
+			scope = adminScope(conf)
+		}
+		if !identity.HasScope(scope) {
+			return errors.New("scope " + scope + " is required")
+		}
+	}
+	return nil
+}
+
+// AuthorizeNetwork checks the allow list and the required scope of a network
+func AuthorizeNetwork(conf param.AuthorizationConfig, identity Identity, networkID string) error {
+	if identity.IsAdmin(conf) {
+		return nil
+	}
+	network, ok := param.Conf.Networks[networkID]
+	if !ok {
+		// unknown networks are rejected by the handlers
+		return nil
+	}
+	if network.RequiredScope != "" && !identity.HasScope(network.RequiredScope) {
+		return errors.New("scope " + network.RequiredScope + " is required for " + networkID)
+	}
+	if len(network.AllowedUsers) > 0 {
+		for _, userID := range network.AllowedUsers {
+			if userID == identity.UserID {
+				return nil
+			}
+		}
+		return errors.New("User is not allowed to use " + networkID)
+	}
+	return nil
+}
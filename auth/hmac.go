@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+// HMACAuthenticator accepts requests forwarded by our gateway, which signs the Uid and X-Scopes headers it sets:
+//
+//	X-Signature = hex(hmac_sha256(secret, method + "\n" + uri + "\n" + X-Timestamp + "\n" + X-Nonce + "\n" + Uid + "\n" + X-Scopes + "\n" + hex(sha256(body))))
+//
+// X-Nonce is unique per request, a nonce is accepted once while its timestamp is within the skew. The nonces are
+// kept in memory so every instance behind the gateway tracks its own.
+type HMACAuthenticator struct {
+	secret  []byte
+	maxSkew time.Duration
+	scopes  []string
+
+	mutex     sync.Mutex
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+// maxNonceLength bounds the memory used by the nonces of a skew window
+const maxNonceLength = 64
+
+func NewHMACAuthenticator(conf param.HMACAuthConfig) (*HMACAuthenticator, error) {
+	if conf.Secret == "" {
+		return nil, errors.New("hmac secret is empty")
+	}
+	maxSkew := time.Duration(conf.MaxSkew) * time.Second
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	return &HMACAuthenticator{
+		secret:    []byte(conf.Secret),
+		maxSkew:   maxSkew,
+		scopes:    conf.Scopes,
+		nonces:    map[string]time.Time{},
+		lastPrune: time.Now(),
+	}, nil
+}
+
+func (authenticator *HMACAuthenticator) Authenticate(req *http.Request) (*Identity, error) {
+	signature := req.Header.Get("X-Signature")
+	if signature == "" {
+		return nil, nil
+	}
+	timestampStr := req.Header.Get("X-Timestamp")
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew > authenticator.maxSkew || skew < -authenticator.maxSkew {
+		return nil, errors.New("request signature is expired")
+	}
+	nonce := req.Header.Get("X-Nonce")
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return nil, ErrUnauthorized
+	}
+
+	body := []byte{}
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	bodyHash := sha256.Sum256(body)
+
+	uid := req.Header.Get("Uid")
+	scopesStr := req.Header.Get("X-Scopes")
+	mac := hmac.New(sha256.New, authenticator.secret)
+	mac.Write([]byte(strings.Join([]string{
+		req.Method,
+		req.URL.RequestURI(),
+		timestampStr,
+		nonce,
+		uid,
+		scopesStr,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")))
+	expected := mac.Sum(nil)
+	actual, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, actual) {
+		return nil, ErrUnauthorized
+	}
+
+	userID, err := strconv.ParseInt(uid, 10, 64)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	if !authenticator.useNonce(nonce, time.Unix(timestamp, 0).Add(authenticator.maxSkew)) {
+		return nil, errors.New("request nonce was already used")
+	}
+	scopes := authenticator.scopes
+	if scopesStr != "" {
+		scopes = strings.Split(scopesStr, " ")
+	}
+	return &Identity{UserID: userID, Scopes: scopes, Method: "hmac"}, nil
+}
+
+// useNonce records a nonce until expiry, it returns false when the nonce is already recorded
+func (authenticator *HMACAuthenticator) useNonce(nonce string, expiry time.Time) bool {
+	authenticator.mutex.Lock()
+	defer authenticator.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(authenticator.lastPrune) > authenticator.maxSkew {
+		for usedNonce, usedExpiry := range authenticator.nonces {
+			if usedExpiry.Before(now) {
+				delete(authenticator.nonces, usedNonce)
+			}
+		}
+		authenticator.lastPrune = now
+	}
+	if usedExpiry, ok := authenticator.nonces[nonce]; ok && !usedExpiry.Before(now) {
+		return false
+	}
+	authenticator.nonces[nonce] = expiry
+	return true
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+// JWTAuthenticator verifies bearer tokens signed with HS256 by a shared secret or with RS256 by a key of the JWKS file
+type JWTAuthenticator struct {
+	issuer    string
+	audience  string
+	secret    []byte
+	keys      map[string]*rsa.PublicKey
+	userClaim string
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func NewJWTAuthenticator(conf param.JWTAuthConfig) (*JWTAuthenticator, error) {
+	authenticator := JWTAuthenticator{
+		issuer:    conf.Issuer,
+		audience:  conf.Audience,
+		secret:    []byte(conf.Secret),
+		keys:      map[string]*rsa.PublicKey{},
+		userClaim: conf.UserClaim,
+	}
+	if authenticator.userClaim == "" {
+		authenticator.userClaim = "sub"
+	}
+	if conf.JWKSFile != "" {
+		file, err := ioutil.ReadFile(conf.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		jwks := struct {
+			Keys []jwk `json:"keys"`
+		}{}
+		err = json.Unmarshal(file, &jwks)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range jwks.Keys {
+			if key.Kty != "RSA" {
+				continue
+			}
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil {
+				return nil, err
+			}
+			authenticator.keys[key.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		}
+	}
+	if len(authenticator.secret) == 0 && len(authenticator.keys) == 0 {
+		return nil, errors.New("jwt needs a secret or a jwks file")
+	}
+	return &authenticator, nil
+}
+
+func (authenticator *JWTAuthenticator) Authenticate(req *http.Request) (*Identity, error) {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(header, "Bearer "), ".")
+	if len(parts) != 3 {
+		return nil, ErrUnauthorized
+	}
+
+	tokenHeader := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	err := decodeSegment(parts[0], &tokenHeader)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch tokenHeader.Alg {
+	case "HS256":
+		if len(authenticator.secret) == 0 {
+			return nil, ErrUnauthorized
+		}
+		mac := hmac.New(sha256.New, authenticator.secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, ErrUnauthorized
+		}
+	case "RS256":
+		key, ok := authenticator.keys[tokenHeader.Kid]
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		hash := sha256.Sum256(signed)
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)
+		if err != nil {
+			return nil, ErrUnauthorized
+		}
+	default:
+		return nil, ErrUnauthorized
+	}
+
+	claims := map[string]interface{}{}
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	err = authenticator.verifyClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := claimToInt64(claims[authenticator.userClaim])
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+	scopes := []string{}
+	switch scope := claims["scope"].(type) {
+	case string:
+		scopes = strings.Fields(scope)
+	}
+	if items, ok := claims["scopes"].([]interface{}); ok {
+		for _, item := range items {
+			if s, ok := item.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return &Identity{UserID: userID, Scopes: scopes, Method: "jwt"}, nil
+}
+
+func (authenticator *JWTAuthenticator) verifyClaims(claims map[string]interface{}) error {
+	now := time.Now().Unix()
+	exp, ok := claims["exp"].(json.Number)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	expiredAt, err := exp.Int64()
+	if err != nil || expiredAt < now {
+		return errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(json.Number); ok {
+		notBefore, err := nbf.Int64()
+		if err != nil || notBefore > now {
+			return errors.New("token is not valid yet")
+		}
+	}
+	if authenticator.issuer != "" && claims["iss"] != authenticator.issuer {
+		return ErrUnauthorized
+	}
+	if authenticator.audience != "" {
+		switch aud := claims["aud"].(type) {
+		case string:
+			if aud != authenticator.audience {
+				return ErrUnauthorized
+			}
+		case []interface{}:
+			found := false
+			for _, item := range aud {
+				if item == authenticator.audience {
+					found = true
+				}
+			}
+			if !found {
+				return ErrUnauthorized
+			}
+		default:
+			return ErrUnauthorized
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func claimToInt64(claim interface{}) (int64, error) {
+	switch value := claim.(type) {
+	case json.Number:
+		return value.Int64()
+	case string:
+		return strconv.ParseInt(value, 10, 64)
+	}
+	return 0, fmt.Errorf("claim %v is not a user id", claim)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/ninjadotorg/handshake-ethereum/auth"
+	"github.com/ninjadotorg/handshake-ethereum/controller"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+	"github.com/ninjadotorg/handshake-ethereum/txservice"
+)
+
+const (
+	maxBatchItems           = 100
+	defaultBatchConcurrency = 4
+	maxBatchConcurrency     = 10
+)
+
+type transferBatchItem struct {
+	ToAddress string `json:"to_address"`
+	// Asset is ETH or the symbol of a token of the network
+	Asset     string `json:"asset"`
+	Amount    string `json:"amount"`
+	AmountWei string `json:"amount_wei"`
+	RefID     int64  `json:"ref_id"`
+}
+
+type transferBatchRequest struct {
+	Items       []transferBatchItem `json:"items"`
+	Concurrency int                 `json:"concurrency"`
+}
+
+// transferBatchHandler pays the items from the key of the network with sequential nonces,
+// the results are stored under the batch ID
+func transferBatchHandler(c *gin.Context) {
+	userID, ok := c.Get("UserID")
+	if !ok || userID.(int64) <= 0 {
+		respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+		return
+	}
+
+	networkIDStr := c.Query("network_id")
+	if networkIDStr == "" {
+		networkIDStr = "rinkeby"
+	}
+	dryRun := c.Query("dry_run") == "true"
+	network, ok := param.Conf.Networks[networkIDStr]
+	if !ok {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+		return
+	}
+	etherClient, ok := etherClients[networkIDStr]
+	if !ok {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+		return
+	}
+	txService, ok := txServices[networkIDStr]
+	if !ok {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+		return
+	}
+
+	req := transferBatchRequest{}
+	err := c.Bind(&req)
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+		return
+	}
+	if len(req.Items) == 0 || len(req.Items) > maxBatchItems {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "items must have 1 to "+strconv.Itoa(maxBatchItems)+" transfers"))
+		return
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	if concurrency > maxBatchConcurrency {
+		concurrency = maxBatchConcurrency
+	}
+
+	privateKey, err := crypto.HexToECDSA(network.PrivateKey)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	etherTotal := big.NewInt(0)
+	tokenTotals := map[string]*big.Int{}
+	tokens := map[string]param.Token{}
+	requests := []txservice.Request{}
+	items := []models.TransferBatchItems{}
+	for i, item := range req.Items {
+		name := "items[" + strconv.Itoa(i) + "]"
+		if !common.IsHexAddress(item.ToAddress) {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, name+".to_address is invalid"))
+			return
+		}
+		toAddress := common.HexToAddress(item.ToAddress)
+
+		if strings.EqualFold(item.Asset, "ETH") {
+			amount, err := controller.ParseAmountParam(item.Amount, item.AmountWei, 18)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, name+": "+err.Error()))
+				return
+			}
+			etherTotal.Add(etherTotal, amount)
+			requests = append(requests, txservice.Request{
+				PrivateKey: privateKey,
+				To:         toAddress,
+				Value:      amount,
+				GasLimit:   transferGasLimit,
+				Record: models.EthereumTransactions{
+					ToAddress: item.ToAddress,
+					Value:     controller.AmountToFloat(amount, 18),
+					RefType:   "batch_transfer",
+					UserID:    userID.(int64),
+				},
+			})
+			items = append(items, models.TransferBatchItems{
+				ItemIndex: i,
+				ToAddress: item.ToAddress,
+				Asset:     "ETH",
+				Amount:    amount.String(),
+				RefID:     item.RefID,
+			})
+			continue
+		}
+
+		token, ok := network.GetToken(item.Asset)
+		if !ok || item.Asset == "" {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, name+".asset is invalid"))
+			return
+		}
+		amount, err := controller.ParseAmountParam(item.Amount, item.AmountWei, token.Decimals)
+		if err != nil {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, name+": "+err.Error()))
+			return
+		}
+		data, err := controller.PackERC20Transfer(toAddress, amount)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		tokenKey := strings.ToLower(token.Address)
+		if _, ok := tokenTotals[tokenKey]; !ok {
+			tokenTotals[tokenKey] = big.NewInt(0)
+			tokens[tokenKey] = token
+		}
+		tokenTotals[tokenKey].Add(tokenTotals[tokenKey], amount)
+		requests = append(requests, txservice.Request{
+			PrivateKey: privateKey,
+			To:         common.HexToAddress(token.Address),
+			Data:       data,
+			GasLimit:   transferGasLimit,
+			Record: models.EthereumTransactions{
+				ToAddress: item.ToAddress,
+				Value:     controller.AmountToFloat(amount, token.Decimals),
+				RefType:   "batch_transfer_token",
+				Contract:  param.CONTRACT_ERC20,
+				UserID:    userID.(int64),
+			},
+		})
+		items = append(items, models.TransferBatchItems{
+			ItemIndex:    i,
+			ToAddress:    item.ToAddress,
+			Asset:        token.Symbol,
+			TokenAddress: token.Address,
+			Amount:       amount.String(),
+			RefID:        item.RefID,
+		})
+	}
+
+	// the fees are counted with the suggested gas price, the transfers are sent with the same gas limit
+	gasPrice, err := etherClient.SuggestGasPrice(context.Background())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	fees := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(transferGasLimit*uint64(len(requests))))
+	balance, err := etherClient.BalanceAt(context.Background(), fromAddress, nil)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if balance.Cmp(new(big.Int).Add(etherTotal, fees)) < 0 {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInsufficientFunds, "ether balance "+controller.FormatAmount(balance, 18)+" is lower than the total of the batch and its fees"))
+		return
+	}
+	for tokenKey, total := range tokenTotals {
+		token := tokens[tokenKey]
+		tokenBalance, err := controller.GetTokenBalance(etherClient, token, fromAddress)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if tokenBalance.Cmp(total) < 0 {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInsufficientFunds, token.Symbol+" balance "+controller.FormatAmount(tokenBalance, token.Decimals)+" is lower than the total of the batch"))
+			return
+		}
+	}
+
+	batch := models.TransferBatches{
+		UserID:      userID.(int64),
+		Network:     networkIDStr,
+		FromAddress: fromAddress.Hex(),
+		ItemCount:   len(items),
+	}
+	for i := range requests {
+		requests[i].DryRun = dryRun
+	}
+	// the batch and its signed transfers are stored before the first one is broadcast
+	persist := func(results []txservice.BatchResult) error {
+		for i, result := range results {
+			items[i].Nonce = int(result.Transaction.Nonce())
+			items[i].Hash = result.Transaction.Hash().Hex()
+		}
+		var err error
+		batch, items, err = controller.CreateTransferBatch(batch, items)
+		if err != nil {
+			return err
+		}
+		for i := range results {
+			results[i].Record.RefID = batch.ID
+		}
+		return nil
+	}
+
+	results, err := txService.SendBatch(requests, concurrency, persist)
+	if err != nil {
+		if batchErr, ok := err.(*txservice.BatchError); ok {
+			apiErr := controller.ToAPIError(batchErr.Err)
+			respondError(c, controller.NewAPIError(apiErr.Code, "items["+strconv.Itoa(batchErr.Index)+"]: "+apiErr.Message))
+			return
+		}
+		respondError(c, err)
+		return
+	}
+	for i, result := range results {
+		if result.Transaction != nil {
+			items[i].Nonce = int(result.Transaction.Nonce())
+		}
+		items[i].Hash = result.Record.Hash
+		if result.Err != nil {
+			items[i].Error = controller.ToAPIError(result.Err).Message
+		}
+	}
+	if !dryRun {
+		batch, items, err = controller.FinishTransferBatch(batch, items)
+		if err != nil {
+			// the transfers were broadcast, their hashes keep the Idempotency-Key like respondSendError
+			hashes := []string{}
+			for _, item := range items {
+				if item.Hash != "" {
+					hashes = append(hashes, item.Hash)
+				}
+			}
+			c.Set("ErrorData", map[string]interface{}{
+				"batch_id": batch.ID,
+				"hashes":   hashes,
+			})
+			respondError(c, err)
+			return
+		}
+	}
+
+	result := map[string]interface{}{
+		"status": 1,
+		"data": map[string]interface{}{
+			"dry_run":  dryRun,
+			"batch_id": batch.ID,
+			"batch":    batch,
+			"items":    items,
+		},
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// getTransferBatchHandler returns a batch with the results of its transfers
+func getTransferBatchHandler(c *gin.Context) {
+	userID, ok := c.Get("UserID")
+	if !ok || userID.(int64) <= 0 {
+		respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "id is invalid"))
+		return
+	}
+	batch, items, err := controller.GetTransferBatch(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	identity, _ := c.Get("Identity")
+	if batch.UserID != userID.(int64) && !identity.(auth.Identity).IsAdmin(param.Conf.Authorization) {
+		respondError(c, controller.NewAPIError(controller.ErrCodeNotFound, "batch is not found"))
+		return
+	}
+
+	result := map[string]interface{}{
+		"status": 1,
+		"data": map[string]interface{}{
+			"batch": batch,
+			"items": items,
+		},
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ParseAmount converts a decimal string like "1.5" into the smallest unit of an asset with the given decimals
+func ParseAmount(amountStr string, decimals int) (*big.Int, error) {
+	amountStr = strings.TrimSpace(amountStr)
+	if amountStr == "" {
+		return nil, errors.New("amount is empty")
+	}
+	intPart := amountStr
+	fracPart := ""
+	if i := strings.Index(amountStr, "."); i >= 0 {
+		intPart = amountStr[:i]
+		fracPart = amountStr[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return nil, fmt.Errorf("amount %s is invalid", amountStr)
+	}
+	for _, ch := range intPart + fracPart {
+		if ch < '0' || ch > '9' {
+			return nil, fmt.Errorf("amount %s is invalid", amountStr)
+		}
+	}
+	if len(fracPart) > decimals {
+		if strings.Trim(fracPart[decimals:], "0") != "" {
+			return nil, fmt.Errorf("amount %s has more than %d decimals", amountStr, decimals)
+		}
+		fracPart = fracPart[:decimals]
+	}
+	fracPart += strings.Repeat("0", decimals-len(fracPart))
+	amount, ok := new(big.Int).SetString("0"+intPart+fracPart, 10)
+	if !ok {
+		return nil, fmt.Errorf("amount %s is invalid", amountStr)
+	}
+	return amount, nil
+}
+
+// FormatAmount converts an amount in the smallest unit back into a decimal string
+func FormatAmount(amount *big.Int, decimals int) string {
+	str := new(big.Int).Abs(amount).String()
+	if len(str) <= decimals {
+		str = strings.Repeat("0", decimals-len(str)+1) + str
+	}
+	intPart := str[:len(str)-decimals]
+	fracPart := strings.TrimRight(str[len(str)-decimals:], "0")
+	if amount.Sign() < 0 {
+		intPart = "-" + intPart
+	}
+	if fracPart == "" {
+		return intPart
+	}
+	return intPart + "." + fracPart
+}
+
+var maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// ParseAmountParam parses a positive amount given either as a decimal string or, when weiStr is set, in the smallest unit
+func ParseAmountParam(amountStr string, weiStr string, decimals int) (*big.Int, error) {
+	var amount *big.Int
+	var err error
+	if weiStr != "" {
+		if amountStr != "" {
+			return nil, errors.New("amount must be given either as a decimal or in wei, not both")
+		}
+		amount, err = ParseAmount(weiStr, 0)
+	} else {
+		amount, err = ParseAmount(amountStr, decimals)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if amount.Sign() <= 0 {
+		return nil, errors.New("amount must be greater than 0")
+	}
+	if amount.Cmp(maxUint256) > 0 {
+		return nil, errors.New("amount is too large")
+	}
+	return amount, nil
+}
+
+// FloatToAmount converts an amount of the configuration or a sum of ethereum_transactions into the smallest unit,
+// the digits beyond decimals are float leftovers and rounded
+func FloatToAmount(amount float64, decimals int) (*big.Int, error) {
+	amountStr := strconv.FormatFloat(amount, 'f', -1, 64)
+	roundUp := false
+	if i := strings.Index(amountStr, "."); i >= 0 && len(amountStr)-i-1 > decimals {
+		roundUp = amountStr[i+1+decimals] >= '5'
+		amountStr = amountStr[:i+1+decimals]
+	}
+	value, err := ParseAmount(amountStr, decimals)
+	if err != nil {
+		return nil, err
+	}
+	if roundUp {
+		value.Add(value, big.NewInt(1))
+	}
+	return value, nil
+}
+
+// AmountToFloat is only meant for limits and reporting, never for building transactions
+func AmountToFloat(amount *big.Int, decimals int) float64 {
+	amountFloat, _ := strconv.ParseFloat(FormatAmount(amount, decimals), 64)
+	return amountFloat
+}
+
+// ParseUint256 parses an unsigned integer argument such as a handshake id
+func ParseUint256(str string) (*big.Int, error) {
+	value, err := ParseAmount(str, 0)
+	if err != nil {
+		return nil, err
+	}
+	if value.Cmp(maxUint256) > 0 {
+		return nil, fmt.Errorf("%s is too large", str)
+	}
+	return value, nil
+}
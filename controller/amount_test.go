@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals int
+		want     string
+		err      bool
+	}{
+		{"1", 18, "1000000000000000000", false},
+		{"1.5", 18, "1500000000000000000", false},
+		{"0.000000000000000001", 18, "1", false},
+		{".5", 6, "500000", false},
+		{"5.", 6, "5000000", false},
+		{" 2.25 ", 2, "225", false},
+		{"1.50", 1, "15", false},
+		{"123", 0, "123", false},
+		{"0", 18, "0", false},
+		{"1.001", 2, "", true},
+		{"0.09999999999999998", 6, "", true},
+		{"", 18, "", true},
+		{".", 18, "", true},
+		{"-1", 18, "", true},
+		{"1e18", 0, "", true},
+		{"1.2.3", 18, "", true},
+		{"0x10", 0, "", true},
+	}
+	for _, test := range tests {
+		amount, err := ParseAmount(test.amount, test.decimals)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseAmount(%q, %d) = %s, want an error", test.amount, test.decimals, amount)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAmount(%q, %d): %v", test.amount, test.decimals, err)
+			continue
+		}
+		if amount.String() != test.want {
+			t.Errorf("ParseAmount(%q, %d) = %s, want %s", test.amount, test.decimals, amount, test.want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals int
+		want     string
+	}{
+		{"1000000000000000000", 18, "1"},
+		{"1500000000000000000", 18, "1.5"},
+		{"1", 18, "0.000000000000000001"},
+		{"0", 18, "0"},
+		{"225", 2, "2.25"},
+		{"123", 0, "123"},
+		{"-1500000", 6, "-1.5"},
+	}
+	for _, test := range tests {
+		amount, _ := new(big.Int).SetString(test.amount, 10)
+		if got := FormatAmount(amount, test.decimals); got != test.want {
+			t.Errorf("FormatAmount(%s, %d) = %s, want %s", test.amount, test.decimals, got, test.want)
+		}
+		if amount.Sign() < 0 {
+			continue
+		}
+		parsed, err := ParseAmount(FormatAmount(amount, test.decimals), test.decimals)
+		if err != nil || parsed.Cmp(amount) != 0 {
+			t.Errorf("ParseAmount(FormatAmount(%s, %d)) = %v, %v", test.amount, test.decimals, parsed, err)
+		}
+	}
+}
+
+func TestParseAmountParam(t *testing.T) {
+	tests := []struct {
+		amount   string
+		wei      string
+		decimals int
+		want     string
+		err      bool
+	}{
+		{"1.5", "", 18, "1500000000000000000", false},
+		{"", "42", 18, "42", false},
+		{"1", "1", 18, "", true},
+		{"0", "", 18, "", true},
+		{"", "0", 18, "", true},
+		{"", "115792089237316195423570985008687907853269984665640564039457584007913129639936", 18, "", true},
+	}
+	for _, test := range tests {
+		amount, err := ParseAmountParam(test.amount, test.wei, test.decimals)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseAmountParam(%q, %q) = %s, want an error", test.amount, test.wei, amount)
+			}
+			continue
+		}
+		if err != nil || amount.String() != test.want {
+			t.Errorf("ParseAmountParam(%q, %q) = %v, %v, want %s", test.amount, test.wei, amount, err, test.want)
+		}
+	}
+}
+
+func TestFloatToAmount(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		decimals int
+		want     string
+	}{
+		{1.5, 18, "1500000000000000000"},
+		{0.1, 18, "100000000000000000"},
+		{0.09999999999999998, 6, "100000"},
+		{0.30000000000000004, 6, "300000"},
+		{0.1234564, 6, "123456"},
+		{1e-20, 18, "0"},
+		{2.75, 0, "3"},
+		{0, 18, "0"},
+	}
+	for _, test := range tests {
+		amount, err := FloatToAmount(test.amount, test.decimals)
+		if err != nil || amount.String() != test.want {
+			t.Errorf("FloatToAmount(%v, %d) = %v, %v, want %s", test.amount, test.decimals, amount, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+var transferBatchesDao = dao.TransferBatchesDao{}
+
+// CreateTransferBatch stores a batch with its signed transfers in one database transaction before they are
+// broadcast, so a transfer which reaches the node is always found by its hash
+func CreateTransferBatch(batch models.TransferBatches, items []models.TransferBatchItems) (models.TransferBatches, []models.TransferBatchItems, error) {
+	tx := models.Database().Begin()
+	batch, err := transferBatchesDao.Create(batch, tx)
+	if err != nil {
+		tx.Rollback()
+		return batch, items, err
+	}
+	for i := range items {
+		items[i].BatchID = batch.ID
+		items[i], err = transferBatchesDao.CreateItem(items[i], tx)
+		if err != nil {
+			tx.Rollback()
+			return batch, items, err
+		}
+	}
+	err = tx.Commit().Error
+	return batch, items, err
+}
+
+// FinishTransferBatch stores the results of the broadcast of the transfers of a batch in one database transaction
+func FinishTransferBatch(batch models.TransferBatches, items []models.TransferBatchItems) (models.TransferBatches, []models.TransferBatchItems, error) {
+	tx := models.Database().Begin()
+	var err error
+	batch.FailedCount = 0
+	for i := range items {
+		if items[i].Error != "" {
+			batch.FailedCount++
+		}
+		items[i], err = transferBatchesDao.UpdateItem(items[i], tx)
+		if err != nil {
+			tx.Rollback()
+			return batch, items, err
+		}
+	}
+	batch, err = transferBatchesDao.Update(batch, tx)
+	if err != nil {
+		tx.Rollback()
+		return batch, items, err
+	}
+	err = tx.Commit().Error
+	return batch, items, err
+}
+
+func GetTransferBatch(id int64) (models.TransferBatches, []models.TransferBatchItems, error) {
+	batch := transferBatchesDao.GetById(id)
+	if batch.ID <= 0 {
+		return batch, nil, NewAPIError(ErrCodeNotFound, "batch is not found")
+	}
+	items, err := transferBatchesDao.GetItems(id)
+	return batch, items, err
+}
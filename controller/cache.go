@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheItem struct {
+	value     interface{}
+	expiredAt time.Time
+}
+
+// Cache is a small in-memory cache for values read from the chain
+type Cache struct {
+	mutex sync.Mutex
+	ttl   time.Duration
+	items map[string]cacheItem
+}
+
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, items: map[string]cacheItem{}}
+}
+
+func (cache *Cache) Get(key string) (interface{}, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	item, ok := cache.items[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(item.expiredAt) {
+		delete(cache.items, key)
+		return nil, false
+	}
+	return item.value, true
+}
+
+func (cache *Cache) Set(key string, value interface{}) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	now := time.Now()
+	for k, item := range cache.items {
+		if now.After(item.expiredAt) {
+			delete(cache.items, k)
+		}
+	}
+	cache.items[key] = cacheItem{value: value, expiredAt: now.Add(cache.ttl)}
+}
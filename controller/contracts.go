@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// PackContractCall encodes a call of a contract method registered in param.ABI_FILES
+func PackContractCall(contract string, method string, args ...interface{}) ([]byte, error) {
+	contractAbi, err := LoadAbi(contract)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := contractAbi.Methods[method]; !ok {
+		return nil, fmt.Errorf("method %s is not found in %s", method, contract)
+	}
+	return contractAbi.Pack(method, args...)
+}
+
+// IsPayable tells whether a contract method accepts ether
+func IsPayable(contract string, method string) bool {
+	_, err := LoadAbi(contract)
+	if err != nil {
+		return false
+	}
+	abisMutex.Lock()
+	defer abisMutex.Unlock()
+	return payables[contract][method]
+}
+
+// ConvertArgs converts JSON params, keyed by the input names of the method, into the go types expected by the abi
+func ConvertArgs(contract string, method string, params map[string]interface{}) ([]interface{}, error) {
+	contractAbi, err := LoadAbi(contract)
+	if err != nil {
+		return nil, err
+	}
+	abiMethod, ok := contractAbi.Methods[method]
+	if !ok {
+		return nil, fmt.Errorf("method %s is not found in %s", method, contract)
+	}
+	args := []interface{}{}
+	for i, input := range abiMethod.Inputs {
+		name := input.Name
+		if name == "" {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		param, ok := params[name]
+		if !ok {
+			return nil, fmt.Errorf("%s is missing", name)
+		}
+		arg, err := ConvertArg(input.Type, param)
+		if err != nil {
+			return nil, fmt.Errorf("%s is invalid: %v", name, err)
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// ConvertArg converts a single JSON value into the go type of an abi type
+func ConvertArg(t abi.Type, param interface{}) (interface{}, error) {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		value, err := toBigInt(param)
+		if err != nil {
+			return nil, err
+		}
+		if t.T == abi.UintTy {
+			if value.Sign() < 0 || value.BitLen() > t.Size {
+				return nil, fmt.Errorf("%s is out of range of %s", value, t)
+			}
+		} else {
+			limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+			if value.Cmp(limit) >= 0 || value.Cmp(new(big.Int).Neg(limit)) < 0 {
+				return nil, fmt.Errorf("%s is out of range of %s", value, t)
+			}
+		}
+		if t.Kind == reflect.Ptr {
+			return value, nil
+		}
+		arg := reflect.New(t.Type).Elem()
+		if t.T == abi.UintTy {
+			arg.SetUint(value.Uint64())
+		} else {
+			arg.SetInt(value.Int64())
+		}
+		return arg.Interface(), nil
+	case abi.BoolTy:
+		// the args of GET calls are query strings
+		switch value := param.(type) {
+		case bool:
+			return value, nil
+		case string:
+			if value == "true" || value == "false" {
+				return value == "true", nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a bool", param)
+	case abi.StringTy:
+		value, ok := param.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", param)
+		}
+		return value, nil
+	case abi.AddressTy:
+		value, ok := param.(string)
+		if !ok || !common.IsHexAddress(value) {
+			return nil, fmt.Errorf("%v is not an address", param)
+		}
+		return common.HexToAddress(value), nil
+	case abi.FixedBytesTy:
+		value, ok := param.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", param)
+		}
+		// a hex value must fill the bytes exactly, any other string is right padded like StringToBytes32
+		if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+			data, err := hexutil.Decode("0x" + value[2:])
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a hex value: %v", value, err)
+			}
+			if len(data) != t.Size {
+				return nil, fmt.Errorf("%s is not %d bytes", value, t.Size)
+			}
+			return toFixedBytes(t, data), nil
+		}
+		data := []byte(value)
+		if len(data) > t.Size {
+			return nil, fmt.Errorf("%s is longer than %d bytes", value, t.Size)
+		}
+		return toFixedBytes(t, data), nil
+	case abi.BytesTy:
+		value, ok := param.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a hex string", param)
+		}
+		return hexutil.Decode(value)
+	case abi.SliceTy, abi.ArrayTy:
+		values, ok := param.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v is not an array", param)
+		}
+		if t.T == abi.ArrayTy && len(values) != t.Size {
+			return nil, fmt.Errorf("%d items are expected", t.Size)
+		}
+		arg := reflect.MakeSlice(reflect.SliceOf(t.Elem.Type), 0, len(values))
+		for _, value := range values {
+			elem, err := ConvertArg(*t.Elem, value)
+			if err != nil {
+				return nil, err
+			}
+			arg = reflect.Append(arg, reflect.ValueOf(elem))
+		}
+		if t.T == abi.ArrayTy {
+			array := reflect.New(t.Type).Elem()
+			reflect.Copy(array, arg)
+			return array.Interface(), nil
+		}
+		return arg.Interface(), nil
+	}
+	return nil, fmt.Errorf("type %s is not supported", t)
+}
+
+func toFixedBytes(t abi.Type, data []byte) interface{} {
+	arg := reflect.New(t.Type).Elem()
+	reflect.Copy(arg, reflect.ValueOf(data))
+	return arg.Interface()
+}
+
+func toBigInt(param interface{}) (*big.Int, error) {
+	str := ""
+	switch value := param.(type) {
+	case json.Number:
+		str = value.String()
+	case string:
+		str = value
+	case float64:
+		if value != math.Trunc(value) || math.Abs(value) > 1<<53 {
+			return nil, fmt.Errorf("%v must be given as a string", value)
+		}
+		str = fmt.Sprintf("%.0f", value)
+	default:
+		return nil, fmt.Errorf("%v is not a number", param)
+	}
+	// numbers are decimal unless they have an explicit 0x prefix, a leading 0 is not octal
+	base := 10
+	digits := str
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		base, digits = 16, digits[2:]
+	}
+	value, ok := new(big.Int).SetString(sign+digits, base)
+	if !ok || digits == "" || strings.HasPrefix(digits, "+") || strings.HasPrefix(digits, "-") {
+		return nil, fmt.Errorf("%s is not a number", str)
+	}
+	return value, nil
+}
+
+// StringToBytes32 right pads an offchain id the same way it is trimmed when events are decoded
+func StringToBytes32(str string) ([32]byte, error) {
+	result := [32]byte{}
+	if len(str) > 32 {
+		return result, fmt.Errorf("%s is longer than 32 bytes", str)
+	}
+	copy(result[:], str)
+	return result, nil
+}
+
+// CallContract runs a constant method at the given block, nil is the latest block, and decodes the outputs into JSON friendly values
+func CallContract(client *ethclient.Client, contract string, contractAddress common.Address, method string, args []interface{}, blockNumber *big.Int) (map[string]interface{}, error) {
+	contractAbi, err := LoadAbi(contract)
+	if err != nil {
+		return nil, err
+	}
+	abiMethod, ok := contractAbi.Methods[method]
+	if !ok {
+		return nil, fmt.Errorf("method %s is not found in %s", method, contract)
+	}
+	data, err := contractAbi.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &contractAddress, Data: data}, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if len(output) == 0 && len(abiMethod.Outputs) > 0 {
+		return nil, NewAPIError(ErrCodeInvalidParam, fmt.Sprintf("%s returned no data, is it a %s contract?", contractAddress.Hex(), contract))
+	}
+	values, err := abiMethod.Outputs.UnpackValues(output)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{}
+	for i, output := range abiMethod.Outputs {
+		name := output.Name
+		if name == "" {
+			name = fmt.Sprintf("output%d", i)
+		}
+		result[name] = FormatValue(values[i])
+	}
+	return result, nil
+}
+
+// FormatValue converts a decoded abi value into JSON without losing precision, big numbers are decimal strings and bytes are hex
+func FormatValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case common.Address:
+		return v.Hex()
+	case common.Hash:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(data), rv)
+			return hexutil.Encode(data)
+		}
+		fallthrough
+	case reflect.Slice:
+		items := []interface{}{}
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, FormatValue(rv.Index(i).Interface()))
+		}
+		return items
+	}
+	return value
+}
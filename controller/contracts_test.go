@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestConvertArg(t *testing.T) {
+	bytes32 := [32]byte{}
+	copy(bytes32[:], "abc")
+	hexBytes4 := [4]byte{0xde, 0xad, 0xbe, 0xef}
+	address := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	large, _ := new(big.Int).SetString("115792089237316195423570985008687907853269984665640564039457584007913129639935", 10)
+
+	tests := []struct {
+		typ   string
+		param interface{}
+		want  interface{}
+		err   bool
+	}{
+		{"uint256", json.Number("42"), big.NewInt(42), false},
+		{"uint256", "0x2a", big.NewInt(42), false},
+		{"uint256", "0X2A", big.NewInt(42), false},
+		{"uint256", float64(42), big.NewInt(42), false},
+		{"uint256", "115792089237316195423570985008687907853269984665640564039457584007913129639935", large, false},
+		{"uint256", "115792089237316195423570985008687907853269984665640564039457584007913129639936", nil, true},
+		{"uint256", "-1", nil, true},
+		{"uint256", "2a", nil, true},
+		{"uint256", "010", big.NewInt(10), false},
+		{"uint256", float64(1.5), nil, true},
+		{"uint8", "255", uint8(255), false},
+		{"uint8", "256", nil, true},
+		{"int8", "-128", int8(-128), false},
+		{"int8", "-0x80", int8(-128), false},
+		{"int8", "128", nil, true},
+		{"int256", "-1", big.NewInt(-1), false},
+		{"bool", true, true, false},
+		{"bool", "false", false, false},
+		{"bool", "yes", nil, true},
+		{"string", "hello", "hello", false},
+		{"string", float64(1), nil, true},
+		{"address", address.Hex(), address, false},
+		{"address", "0x1234", nil, true},
+		{"bytes32", "abc", bytes32, false},
+		{"bytes4", "0xdeadbeef", hexBytes4, false},
+		{"bytes4", "0xdead", nil, true},
+		{"bytes4", "0xzzzzzzzz", nil, true},
+		{"bytes4", "abcde", nil, true},
+		{"bytes", "0x0102", []byte{1, 2}, false},
+		{"bytes", "0102", nil, true},
+		{"uint256[]", []interface{}{"1", json.Number("2")}, []*big.Int{big.NewInt(1), big.NewInt(2)}, false},
+		{"address[2]", []interface{}{address.Hex(), address.Hex()}, [2]common.Address{address, address}, false},
+		{"address[2]", []interface{}{address.Hex()}, nil, true},
+		{"bool[]", "true", nil, true},
+	}
+	for _, test := range tests {
+		typ, err := abi.NewType(test.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arg, err := ConvertArg(typ, test.param)
+		if test.err {
+			if err == nil {
+				t.Errorf("ConvertArg(%s, %#v) = %#v, want an error", test.typ, test.param, arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ConvertArg(%s, %#v): %v", test.typ, test.param, err)
+			continue
+		}
+		if !reflect.DeepEqual(arg, test.want) {
+			t.Errorf("ConvertArg(%s, %#v) = %#v, want %#v", test.typ, test.param, arg, test.want)
+		}
+	}
+}
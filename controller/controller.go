@@ -1,20 +1,20 @@
 package controller
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
-	"io/ioutil"
 	"log"
 	"math/big"
-	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ninjadotorg/handshake-ethereum/dao"
 	"github.com/ninjadotorg/handshake-ethereum/models"
@@ -25,10 +25,12 @@ import (
 var (
 	ethereumLogsDao         = dao.EthereumLogsDao{}
 	ethereumTransactionsDao = dao.EthereumTransactionsDao{}
+	logScansDao             = dao.LogScansDao{}
 )
 
 type Controller struct {
-	LogsProcessers []*LogsProcesser
+	LogsProcessers  []*LogsProcesser
+	DepositScanners []*DepositScanner
 }
 
 type LogsProcesser struct {
@@ -38,6 +40,10 @@ type LogsProcesser struct {
 	Topics      []string
 	Abi         abi.ABI
 	PubsubTopic *pubsub.Topic
+
+	// running is set while a scan is going, the scan of the next tick is skipped
+	mutex   sync.Mutex
+	running bool
 }
 
 func NewConcotrller(agrs []param.Agr) (*Controller, error) {
@@ -48,7 +54,12 @@ func NewConcotrller(agrs []param.Agr) (*Controller, error) {
 		log.Println(err)
 		return nil, err
 	}
-	for _, agr := range agrs {
+	tokenAgrs, err := TokenAgrs(agrs, param.Conf.Networks)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	for _, agr := range append(agrs, tokenAgrs...) {
 		processer, err := NewLogsProcesser(agr, pubsubClient)
 		if err != nil {
 			log.Println(err)
@@ -56,6 +67,17 @@ func NewConcotrller(agrs []param.Agr) (*Controller, error) {
 		}
 		controller.LogsProcessers = append(controller.LogsProcessers, processer)
 	}
+	for network, conf := range param.Conf.Networks {
+		if !conf.Deposits.Enabled {
+			continue
+		}
+		scanner, err := NewDepositScanner(network, conf, pubsubClient)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		controller.DepositScanners = append(controller.DepositScanners, scanner)
+	}
 	return &controller, nil
 }
 
@@ -65,6 +87,24 @@ func (controller *Controller) Process() {
 	}
 }
 
+// BackfillHandshakes runs the backfill of the handshake contracts one after the other
+func (controller *Controller) BackfillHandshakes() error {
+	for _, processer := range controller.LogsProcessers {
+		err := processer.BackfillHandshakes()
+		if err != nil {
+			log.Println("Controller.BackfillHandshakes()", processer.Agr.ContractAddress, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (controller *Controller) ScanDeposits() {
+	for _, scanner := range controller.DepositScanners {
+		go scanner.Process()
+	}
+}
+
 func NewLogsProcesser(agr param.Agr, pubsubClient *pubsub.Client) (*LogsProcesser, error) {
 	processer := LogsProcesser{}
 	processer.Agr = agr
@@ -77,17 +117,7 @@ func NewLogsProcesser(agr param.Agr, pubsubClient *pubsub.Client) (*LogsProcesse
 	processer.Addresses = []common.Address{
 		common.HexToAddress(agr.ContractAddress),
 	}
-	path, err := filepath.Abs(param.ABI_FILES[agr.Contract])
-	if err != nil {
-		log.Println("NewLogsProcesser", err)
-		return nil, err
-	}
-	file, err := ioutil.ReadFile(path)
-	if err != nil {
-		log.Println("NewLogsProcesser", err)
-		return nil, err
-	}
-	abiIns, err := abi.JSON(strings.NewReader(string(file)))
+	abiIns, err := LoadAbi(agr.Contract)
 	if err != nil {
 		log.Println("NewLogsProcesser", err)
 		return nil, err
@@ -111,54 +141,118 @@ func NewLogsProcesser(agr param.Agr, pubsubClient *pubsub.Client) (*LogsProcesse
 	return &processer, nil
 }
 
+// Process scans the logs of every event of the contract, the logs are processed one after the other and it returns
+// at once when the previous run is still going
 func (processer *LogsProcesser) Process() error {
+	processer.mutex.Lock()
+	if processer.running {
+		processer.mutex.Unlock()
+		return nil
+	}
+	processer.running = true
+	processer.mutex.Unlock()
+	defer func() {
+		processer.mutex.Lock()
+		processer.running = false
+		processer.mutex.Unlock()
+	}()
+
 	log.Println("contract address", processer.Agr.ContractAddress)
 	for _, event := range processer.Abi.Events {
 		log.Println("LogsProcesser.Process() for event ", event)
 
-		contractLogs := ethereumLogsDao.GetByFilter(processer.Agr.ContractAddress, event.Name)
 		q := ethereum.FilterQuery{}
 		q.Addresses = processer.Addresses
-		q.FromBlock = nil
-		if contractLogs.ID > 0 {
-			q.FromBlock = big.NewInt(contractLogs.BlockNumber + 1)
-		}
+		q.FromBlock = processer.fromBlock(event.Name)
 		q.ToBlock = nil
+		if processer.Agr.MaxBlocks > 0 {
+			header, err := processer.Client.HeaderByNumber(context.Background(), nil)
+			if err != nil {
+				log.Println("LogsProcesser.Process()", err)
+				return err
+			}
+			fromBlock := int64(0)
+			if q.FromBlock != nil {
+				fromBlock = q.FromBlock.Int64()
+			}
+			toBlock := fromBlock + processer.Agr.MaxBlocks - 1
+			if toBlock > header.Number.Int64() {
+				toBlock = header.Number.Int64()
+			}
+			if fromBlock > toBlock {
+				continue
+			}
+			q.FromBlock = big.NewInt(fromBlock)
+			q.ToBlock = big.NewInt(toBlock)
+		}
 		q.Topics = [][]common.Hash{[]common.Hash{processer.Abi.Events[event.Name].Id()}}
 		etherLogs, err := processer.Client.FilterLogs(context.Background(), q)
 		if err != nil {
 			log.Println("LogsProcesser.Process()", err)
 			return err
 		}
-		abiStructs := param.ABI_STRUCTS[processer.Agr.Contract]
+		failed := false
 		for _, etherLog := range etherLogs {
 			hash := etherLog.TxHash.String()
 
-			val, ok := abiStructs[event.Name]
-			if !ok {
-				log.Println(errors.New("event " + event.Name + " struct is missed"))
+			data, err := processer.decodeLog(event, etherLog)
+			if err != nil {
+				log.Println("LogsProcesser.Process()", err)
+				failed = true
 				break
 			}
-			outptr := reflect.New(reflect.TypeOf(val))
-			err = processer.Abi.Unpack(outptr.Interface(), event.Name, etherLog.Data)
+			processer.ProcessMessage(processer.Agr.ChainID, processer.Agr.ContractAddress, event.Name, int64(etherLog.BlockNumber), int64(etherLog.Index), hash, data)
+		}
+		if q.ToBlock != nil && !failed {
+			scan := logScansDao.GetScan(processer.Agr.ChainID, processer.Agr.ContractAddress, event.Name)
+			scan.ChainID = processer.Agr.ChainID
+			scan.ContractAddress = processer.Agr.ContractAddress
+			scan.Event = event.Name
+			scan.BlockNumber = q.ToBlock.Int64()
+			_, err = logScansDao.SaveScan(scan, nil)
 			if err != nil {
-				if err != nil {
-					log.Println("LogsProcesser.Process()", err)
-					break
-				}
-			} else {
-				data, err := processer.MigrateData(event.Name, outptr.Interface())
-				if err != nil {
-					log.Println("LogsProcesser.Process()", err)
-					break
-				}
-				go processer.ProcessMessage(processer.Agr.ChainID, processer.Agr.ContractAddress, event.Name, int64(etherLog.BlockNumber), int64(etherLog.Index), hash, data)
+				log.Println("LogsProcesser.Process()", err)
+				return err
 			}
 		}
 	}
 	return nil
 }
 
+// fromBlock returns the first block of the next scan of event: the block after the last page scanned, the block
+// after the last indexed log or Agr.StartBlock, nil is the genesis
+func (processer *LogsProcesser) fromBlock(event string) *big.Int {
+	scan := logScansDao.GetScan(processer.Agr.ChainID, processer.Agr.ContractAddress, event)
+	if scan.ID > 0 {
+		return big.NewInt(scan.BlockNumber + 1)
+	}
+	contractLogs := ethereumLogsDao.GetByFilter(processer.Agr.ContractAddress, event)
+	if contractLogs.ID > 0 {
+		return big.NewInt(contractLogs.BlockNumber + 1)
+	}
+	if processer.Agr.StartBlock > 0 {
+		return big.NewInt(processer.Agr.StartBlock)
+	}
+	return nil
+}
+
+// decodeLog decodes a log of event with the struct of param.ABI_STRUCTS, the contracts without structs,
+// e.g. the built-in erc20, are decoded from the abi
+func (processer *LogsProcesser) decodeLog(event abi.Event, etherLog types.Log) (map[string]interface{}, error) {
+	val, ok := param.ABI_STRUCTS[processer.Agr.Contract][event.Name]
+	if !ok {
+		return DecodeLog(event, etherLog)
+	}
+	outptr := reflect.New(reflect.TypeOf(val))
+	err := processer.Abi.Unpack(outptr.Interface(), event.Name, etherLog.Data)
+	if err != nil {
+		return nil, err
+	}
+	return processer.MigrateData(event.Name, outptr.Interface())
+}
+
+// MigrateData converts a decoded struct to the data of a log, the numbers are kept as exact json numbers since
+// the uint256 values (*big.Int) exceed int64 and float64, and the bytes32 values are trimmed strings
 func (processer *LogsProcesser) MigrateData(event string, source interface{}) (map[string]interface{}, error) {
 	result := map[string]interface{}{}
 
@@ -167,7 +261,9 @@ func (processer *LogsProcesser) MigrateData(event string, source interface{}) (m
 		log.Println("LogsProcesser.MigrateData()", err)
 		return result, err
 	}
-	err = json.Unmarshal(jsonStr, &result)
+	decoder := json.NewDecoder(bytes.NewReader(jsonStr))
+	decoder.UseNumber()
+	err = decoder.Decode(&result)
 	if err != nil {
 		log.Println("LogsProcesser.MigrateData()", err)
 		return result, err
@@ -178,8 +274,7 @@ func (processer *LogsProcesser) MigrateData(event string, source interface{}) (m
 		default:
 			log.Println("LogsProcesser.MigrateData() unexpected type pos 1 %T", v)
 			break
-		case float64:
-			result[k] = int64(v.(float64))
+		case json.Number:
 			break
 		case []interface{}:
 			str := ""
@@ -188,8 +283,9 @@ func (processer *LogsProcesser) MigrateData(event string, source interface{}) (m
 				default:
 					log.Println("LogsProcesser.MigrateData() unexpected type pos 2 %T", v)
 					break
-				case float64:
-					str += string([]byte{byte(i.(float64))})
+				case json.Number:
+					b, _ := i.(json.Number).Int64()
+					str += string([]byte{byte(b)})
 					break
 				}
 			}
@@ -204,16 +300,24 @@ func (processer *LogsProcesser) MigrateData(event string, source interface{}) (m
 
 func (processer *LogsProcesser) ProcessMessage(chainId int, contractAddress string, event string, blockNumber int64, logIndex int64, hash string, data map[string]interface{}) error {
 	fromAddress := ""
+	value := ""
 	transaction, _, err := processer.Client.TransactionByHash(context.Background(), common.HexToHash(hash))
 	if err != nil {
 		log.Println("LogsProcesser.ProcessMessage()", err)
 	} else {
 		fromAddress = transaction.From().String()
+		value = transaction.Value().String()
 	}
-	ethereumLogs, err := processer.SaveDB(processer.Agr.ChainID, fromAddress, processer.Agr.ContractAddress, event, blockNumber, logIndex, hash, data)
+	ethereumLogs, err := processer.SaveDB(processer.Agr.ChainID, fromAddress, processer.Agr.ContractAddress, event, blockNumber, logIndex, hash, value, data)
 	if err != nil {
 		log.Println("LogsProcesser.ProcessMessage()", err)
 	}
+	if hid, ok := logAmount(data["hid"]); ok && IsHandshakeContract(processer.Agr.Contract) {
+		err = processer.ProjectHandshake(hid, ethereumLogs)
+		if err != nil {
+			log.Println("LogsProcesser.ProcessMessage()", err)
+		}
+	}
 	res, err := processer.PubSub(processer.Agr.ChainID, fromAddress, processer.Agr.ContractAddress, event, blockNumber, logIndex, hash, data)
 	if err != nil {
 		log.Println("LogsProcesser.ProcessMessage()", err)
@@ -234,7 +338,7 @@ func (processer *LogsProcesser) ProcessMessage(chainId int, contractAddress stri
 	return nil
 }
 
-func (processer *LogsProcesser) SaveDB(chainId int, fromAddress string, contractAddress string, event string, blockNumber int64, logIndex int64, hash string, data map[string]interface{}) (models.EthereumLogs, error) {
+func (processer *LogsProcesser) SaveDB(chainId int, fromAddress string, contractAddress string, event string, blockNumber int64, logIndex int64, hash string, value string, data map[string]interface{}) (models.EthereumLogs, error) {
 	ethereumLogs := models.EthereumLogs{}
 
 	jsonStr, err := json.Marshal(data)
@@ -254,6 +358,7 @@ func (processer *LogsProcesser) SaveDB(chainId int, fromAddress string, contract
 	ethereumLogs.LogIndex = logIndex
 	ethereumLogs.Hash = hash
 	ethereumLogs.Data = string(jsonStr)
+	ethereumLogs.Value = value
 
 	ethereumLogs, err = ethereumLogsDao.Create(ethereumLogs, nil)
 	if err != nil {
@@ -0,0 +1,400 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+// The events of the deposits published with the contract logs. The blocks are scanned once they have enough
+// confirmations so a deposit is published once as confirmed, the deposits stored pending by the previous
+// versions are published once more when they are confirmed or dropped.
+const (
+	DepositEvent          = "__deposit"
+	DepositConfirmedEvent = "__deposit_confirmed"
+	DepositDroppedEvent   = "__deposit_dropped"
+)
+
+// depositTopicsChunk is the number of watched addresses matched by a FilterLogs call
+const depositTopicsChunk = 100
+
+var (
+	watchedAddressesDao = dao.WatchedAddressesDao{}
+	depositsDao         = dao.DepositsDao{}
+)
+
+// DepositScanner walks the blocks of a network for the ether and token transfers received by the watched addresses
+type DepositScanner struct {
+	Network     string
+	Conf        param.Network
+	Client      *ethclient.Client
+	ChainID     int
+	PubsubTopic *pubsub.Topic
+
+	mutex   sync.Mutex
+	running bool
+}
+
+func NewDepositScanner(network string, conf param.Network, pubsubClient *pubsub.Client) (*DepositScanner, error) {
+	scanner := DepositScanner{Network: network, Conf: conf}
+	client, err := ethclient.Dial(conf.NetworkURL)
+	if err != nil {
+		log.Println("NewDepositScanner", err)
+		return nil, err
+	}
+	scanner.Client = client
+	chainID, err := NetworkChainID(client, conf)
+	if err != nil {
+		log.Println("NewDepositScanner", err)
+		return nil, err
+	}
+	scanner.ChainID = int(chainID.Int64())
+
+	topicName := conf.Deposits.TopicName
+	if topicName != "" {
+		pubsubTopic := pubsubClient.Topic(topicName)
+		existed, err := pubsubTopic.Exists(context.Background())
+		if err == nil && !existed {
+			pubsubTopic, err = pubsubClient.CreateTopic(context.Background(), topicName)
+		}
+		if err != nil {
+			log.Println("NewDepositScanner", err)
+		} else {
+			scanner.PubsubTopic = pubsubTopic
+		}
+	}
+	return &scanner, nil
+}
+
+// WatchAddress adds address to the addresses the deposit scanner of network looks for
+func WatchAddress(network string, userID int64, address string) error {
+	if watchedAddressesDao.GetByAddress(network, address).ID > 0 {
+		return nil
+	}
+	_, err := watchedAddressesDao.Create(models.WatchedAddresses{UserID: userID, Network: network, Address: address}, nil)
+	if dao.IsDuplicateKey(err) {
+		// a concurrent request watches it
+		return nil
+	}
+	return err
+}
+
+// Process scans the blocks following the last scanned one and updates the confirmations of the pending deposits,
+// it returns at once when the previous run is still going
+func (scanner *DepositScanner) Process() error {
+	scanner.mutex.Lock()
+	if scanner.running {
+		scanner.mutex.Unlock()
+		return nil
+	}
+	scanner.running = true
+	scanner.mutex.Unlock()
+	defer func() {
+		scanner.mutex.Lock()
+		scanner.running = false
+		scanner.mutex.Unlock()
+	}()
+
+	header, err := scanner.Client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		log.Println("DepositScanner.Process()", scanner.Network, err)
+		return err
+	}
+	head := header.Number.Int64()
+	// a block is never scanned twice, only the blocks with enough confirmations are scanned so a reorg
+	// can not replace a block after it was scanned
+	confirmedHead := head - scanner.confirmations() + 1
+
+	scan := depositsDao.GetScan(scanner.Network)
+	fromBlock := scan.BlockNumber + 1
+	if scan.ID <= 0 {
+		scan.Network = scanner.Network
+		fromBlock = scanner.Conf.Deposits.StartBlock
+		if fromBlock <= 0 {
+			fromBlock = confirmedHead
+		}
+	}
+	maxBlocks := scanner.Conf.Deposits.MaxBlocks
+	if maxBlocks <= 0 {
+		maxBlocks = 100
+	}
+	toBlock := fromBlock + maxBlocks - 1
+	if toBlock > confirmedHead {
+		toBlock = confirmedHead
+	}
+
+	if fromBlock <= toBlock {
+		watched, err := scanner.watched()
+		if err != nil {
+			return err
+		}
+		if len(watched) > 0 {
+			err = scanner.scanEther(fromBlock, toBlock, head, watched)
+			if err != nil {
+				log.Println("DepositScanner.Process()", scanner.Network, err)
+				return err
+			}
+			err = scanner.scanTokens(fromBlock, toBlock, head, watched)
+			if err != nil {
+				log.Println("DepositScanner.Process()", scanner.Network, err)
+				return err
+			}
+		}
+		scan.BlockNumber = toBlock
+		_, err = depositsDao.SaveScan(scan, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.confirm(head)
+}
+
+func (scanner *DepositScanner) watched() (map[string]models.WatchedAddresses, error) {
+	watchedAddresses, err := watchedAddressesDao.GetListByNetwork(scanner.Network)
+	if err != nil {
+		return nil, err
+	}
+	watched := map[string]models.WatchedAddresses{}
+	for _, watchedAddress := range watchedAddresses {
+		watched[strings.ToLower(watchedAddress.Address)] = watchedAddress
+	}
+	return watched, nil
+}
+
+// scanEther matches the recipients of the transactions of the blocks, ether transfers do not produce logs.
+// Only the value of the transactions themselves is seen, ether sent to a watched address by a contract
+// (an internal transaction) is missed since it needs the traces of the node.
+func (scanner *DepositScanner) scanEther(fromBlock int64, toBlock int64, head int64, watched map[string]models.WatchedAddresses) error {
+	for number := fromBlock; number <= toBlock; number++ {
+		block, err := scanner.Client.BlockByNumber(context.Background(), big.NewInt(number))
+		if err != nil {
+			return err
+		}
+		for _, tx := range block.Transactions() {
+			if tx.To() == nil || tx.Value().Sign() <= 0 {
+				continue
+			}
+			watchedAddress, ok := watched[strings.ToLower(tx.To().Hex())]
+			if !ok {
+				continue
+			}
+			receipt, err := scanner.Client.TransactionReceipt(context.Background(), tx.Hash())
+			if err != nil {
+				return err
+			}
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				continue
+			}
+			from, err := types.Sender(TransactionSigner(tx), tx)
+			if err != nil {
+				return err
+			}
+			err = scanner.save(models.Deposits{
+				UserID:      watchedAddress.UserID,
+				Address:     watchedAddress.Address,
+				FromAddress: from.Hex(),
+				Asset:       "ETH",
+				Amount:      tx.Value().String(),
+				Hash:        tx.Hash().Hex(),
+				BlockNumber: number,
+				LogIndex:    -1,
+			}, head)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// scanTokens matches the Transfer logs of the tokens of the network sent to the watched addresses,
+// the addresses are matched depositTopicsChunk at a time to keep the filters small
+func (scanner *DepositScanner) scanTokens(fromBlock int64, toBlock int64, head int64, watched map[string]models.WatchedAddresses) error {
+	tokens := map[common.Address]param.Token{}
+	q := ethereum.FilterQuery{}
+	for _, token := range scanner.Conf.GetTokens() {
+		if token.Address == "" {
+			continue
+		}
+		tokens[common.HexToAddress(token.Address)] = token
+		q.Addresses = append(q.Addresses, common.HexToAddress(token.Address))
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	erc20Abi, err := LoadAbi(param.CONTRACT_ERC20)
+	if err != nil {
+		return err
+	}
+	transferEvent, ok := erc20Abi.Events["Transfer"]
+	if !ok {
+		return errors.New("event Transfer is missed in the erc20 abi")
+	}
+	recipients := []common.Hash{}
+	for address := range watched {
+		recipients = append(recipients, common.BytesToHash(common.HexToAddress(address).Bytes()))
+	}
+	q.FromBlock = big.NewInt(fromBlock)
+	q.ToBlock = big.NewInt(toBlock)
+
+	etherLogs := []types.Log{}
+	for start := 0; start < len(recipients); start += depositTopicsChunk {
+		end := start + depositTopicsChunk
+		if end > len(recipients) {
+			end = len(recipients)
+		}
+		q.Topics = [][]common.Hash{[]common.Hash{transferEvent.Id()}, nil, recipients[start:end]}
+		chunkLogs, err := scanner.Client.FilterLogs(context.Background(), q)
+		if err != nil {
+			return err
+		}
+		etherLogs = append(etherLogs, chunkLogs...)
+	}
+	for _, etherLog := range etherLogs {
+		if etherLog.Removed || len(etherLog.Topics) < 3 {
+			continue
+		}
+		to := common.BytesToAddress(etherLog.Topics[2].Bytes())
+		watchedAddress, ok := watched[strings.ToLower(to.Hex())]
+		if !ok {
+			continue
+		}
+		token := tokens[etherLog.Address]
+		err = scanner.save(models.Deposits{
+			UserID:       watchedAddress.UserID,
+			Address:      watchedAddress.Address,
+			FromAddress:  common.BytesToAddress(etherLog.Topics[1].Bytes()).Hex(),
+			Asset:        token.Symbol,
+			TokenAddress: etherLog.Address.Hex(),
+			Amount:       new(big.Int).SetBytes(etherLog.Data).String(),
+			Hash:         etherLog.TxHash.Hex(),
+			BlockNumber:  int64(etherLog.BlockNumber),
+			LogIndex:     int64(etherLog.Index),
+		}, head)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (scanner *DepositScanner) confirmations() int64 {
+	if scanner.Conf.Deposits.Confirmations <= 0 {
+		return 12
+	}
+	return scanner.Conf.Deposits.Confirmations
+}
+
+// save stores and publishes a new deposit, a deposit already stored by a previous or a concurrent run is skipped
+func (scanner *DepositScanner) save(deposit models.Deposits, head int64) error {
+	if depositsDao.GetByLog(scanner.Network, deposit.Hash, deposit.LogIndex).ID > 0 {
+		return nil
+	}
+	deposit.Network = scanner.Network
+	deposit.Confirmations = head - deposit.BlockNumber + 1
+	if deposit.Confirmations >= scanner.confirmations() {
+		deposit.Status = 1
+	}
+	deposit, err := depositsDao.Create(deposit, nil)
+	if dao.IsDuplicateKey(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	scanner.publish(deposit)
+	return nil
+}
+
+// confirm updates the confirmations of the pending deposits, a deposit whose transaction
+// is no longer in the chain when it reaches the confirmations is dropped
+func (scanner *DepositScanner) confirm(head int64) error {
+	deposits, err := depositsDao.GetPending(scanner.Network)
+	if err != nil {
+		return err
+	}
+	for _, deposit := range deposits {
+		deposit.Confirmations = head - deposit.BlockNumber + 1
+		if deposit.Confirmations >= scanner.confirmations() {
+			receipt, err := scanner.Client.TransactionReceipt(context.Background(), common.HexToHash(deposit.Hash))
+			if err == ethereum.NotFound {
+				deposit.Status = -1
+			} else if err != nil {
+				log.Println("DepositScanner.confirm()", scanner.Network, err)
+				return err
+			} else if receipt.Status != types.ReceiptStatusSuccessful {
+				deposit.Status = -1
+			} else {
+				deposit.Status = 1
+			}
+		}
+		deposit, err = depositsDao.Update(deposit, nil)
+		if err != nil {
+			return err
+		}
+		if deposit.Status != 0 {
+			scanner.publish(deposit)
+		}
+	}
+	return nil
+}
+
+// publish sends the deposit in the format of the contract logs, the event follows its status
+func (scanner *DepositScanner) publish(deposit models.Deposits) {
+	event := DepositEvent
+	if deposit.Status == 1 {
+		event = DepositConfirmedEvent
+	} else if deposit.Status == -1 {
+		event = DepositDroppedEvent
+	}
+	pubsubData := map[string]interface{}{}
+	pubsubData["chain_id"] = scanner.ChainID
+	pubsubData["from_address"] = deposit.FromAddress
+	pubsubData["contract_address"] = deposit.TokenAddress
+	pubsubData["event"] = event
+	pubsubData["block_number"] = deposit.BlockNumber
+	pubsubData["log_index"] = deposit.LogIndex
+	pubsubData["hash"] = deposit.Hash
+	pubsubData["data"] = map[string]interface{}{
+		"network":       deposit.Network,
+		"user_id":       deposit.UserID,
+		"address":       deposit.Address,
+		"asset":         deposit.Asset,
+		"amount_wei":    deposit.Amount,
+		"confirmations": deposit.Confirmations,
+		"status":        deposit.Status,
+	}
+	jsonStr, err := json.Marshal(pubsubData)
+	if err != nil {
+		log.Println("DepositScanner.publish()", err)
+		return
+	}
+	log.Println(string(jsonStr))
+	if scanner.PubsubTopic == nil {
+		return
+	}
+	res := scanner.PubsubTopic.Publish(context.Background(), &pubsub.Message{Data: jsonStr})
+	serverID, err := res.Get(context.Background())
+	if err != nil {
+		log.Println("DepositScanner.publish()", err)
+		return
+	}
+	deposit.PubsubMsgId = serverID
+	_, err = depositsDao.Update(deposit, nil)
+	if err != nil {
+		log.Println("DepositScanner.publish()", err)
+	}
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+var (
+	abis      = map[string]abi.ABI{}
+	payables  = map[string]map[string]bool{}
+	abisMutex = sync.Mutex{}
+)
+
+// LoadAbi parses the abi file registered in param.ABI_FILES, parsed abis are cached
+func LoadAbi(contract string) (abi.ABI, error) {
+	abisMutex.Lock()
+	defer abisMutex.Unlock()
+	abiIns, ok := abis[contract]
+	if ok {
+		return abiIns, nil
+	}
+	path, err := filepath.Abs(param.ABI_FILES[contract])
+	if err != nil {
+		return abiIns, err
+	}
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return abiIns, err
+	}
+	abiIns, err = abi.JSON(strings.NewReader(string(file)))
+	if err != nil {
+		return abiIns, err
+	}
+	// abi.Method does not keep the payable flag
+	fields := []struct {
+		Type            string `json:"type"`
+		Name            string `json:"name"`
+		Payable         bool   `json:"payable"`
+		StateMutability string `json:"stateMutability"`
+	}{}
+	err = json.Unmarshal(file, &fields)
+	if err != nil {
+		return abiIns, err
+	}
+	payables[contract] = map[string]bool{}
+	for _, field := range fields {
+		if field.Type == "function" && (field.Payable || field.StateMutability == "payable") {
+			payables[contract][field.Name] = true
+		}
+	}
+	abis[contract] = abiIns
+	return abiIns, nil
+}
+
+func PackERC20Transfer(toAddress common.Address, amount *big.Int) ([]byte, error) {
+	erc20Abi, err := LoadAbi(param.CONTRACT_ERC20)
+	if err != nil {
+		return nil, err
+	}
+	return erc20Abi.Pack("transfer", toAddress, amount)
+}
+
+func GetTokenBalance(client *ethclient.Client, token param.Token, address common.Address) (*big.Int, error) {
+	var balance *big.Int
+	err := callERC20(client, token, &balance, "balanceOf", address)
+	return balance, err
+}
+
+func GetTokenAllowance(client *ethclient.Client, token param.Token, owner common.Address, spender common.Address) (*big.Int, error) {
+	var allowance *big.Int
+	err := callERC20(client, token, &allowance, "allowance", owner, spender)
+	return allowance, err
+}
+
+func callERC20(client *ethclient.Client, token param.Token, result interface{}, method string, args ...interface{}) error {
+	erc20Abi, err := LoadAbi(param.CONTRACT_ERC20)
+	if err != nil {
+		return err
+	}
+	data, err := erc20Abi.Pack(method, args...)
+	if err != nil {
+		return err
+	}
+	tokenAddress := common.HexToAddress(token.Address)
+	output, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &tokenAddress, Data: data}, nil)
+	if err != nil {
+		return err
+	}
+	return erc20Abi.Unpack(result, method, output)
+}
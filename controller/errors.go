@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ninjadotorg/handshake-ethereum/txservice"
+)
+
+const (
+	ErrCodeInvalidParam         = "invalid_param"
+	ErrCodeUnauthorized         = "unauthorized"
+	ErrCodeForbidden            = "forbidden"
+	ErrCodeNotFound             = "not_found"
+	ErrCodeIdempotencyConflict  = "idempotency_conflict"
+	ErrCodeNonceConflict        = "nonce_conflict"
+	ErrCodeInsufficientFunds    = "insufficient_funds"
+	ErrCodeExecutionReverted    = "execution_reverted"
+	ErrCodeTransactionRejected  = "transaction_rejected"
+	ErrCodeRateLimited          = "rate_limited"
+	ErrCodeNodeUnavailable      = "node_unavailable"
+	ErrCodeInternalError        = "internal_error"
+	internalErrorMessage        = "internal error"
+	nodeUnavailableErrorMessage = "ethereum node is unavailable"
+)
+
+var errorHTTPStatus = map[string]int{
+	ErrCodeInvalidParam:        http.StatusBadRequest,
+	ErrCodeUnauthorized:        http.StatusUnauthorized,
+	ErrCodeForbidden:           http.StatusForbidden,
+	ErrCodeNotFound:            http.StatusNotFound,
+	ErrCodeIdempotencyConflict: http.StatusConflict,
+	ErrCodeNonceConflict:       http.StatusConflict,
+	ErrCodeInsufficientFunds:   http.StatusUnprocessableEntity,
+	ErrCodeExecutionReverted:   http.StatusUnprocessableEntity,
+	ErrCodeTransactionRejected: http.StatusUnprocessableEntity,
+	ErrCodeRateLimited:         http.StatusTooManyRequests,
+	ErrCodeNodeUnavailable:     http.StatusServiceUnavailable,
+	ErrCodeInternalError:       http.StatusInternalServerError,
+}
+
+// APIError is an error with a stable code returned to the API clients
+type APIError struct {
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func NewAPIError(code string, message string) *APIError {
+	return &APIError{Code: code, Message: message}
+}
+
+func (err *APIError) Error() string {
+	return err.Message
+}
+
+// HTTPStatus returns the http status code of the error code
+func (err *APIError) HTTPStatus() int {
+	status, ok := errorHTTPStatus[err.Code]
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+// ToAPIError maps an error returned by the controllers or the ethereum node to an APIError,
+// errors which are not known are logged and hidden behind internal_error
+func ToAPIError(err error) *APIError {
+	if err == txservice.ErrBatchStopped {
+		return NewAPIError(ErrCodeTransactionRejected, err.Error())
+	}
+	switch e := err.(type) {
+	case *APIError:
+		return e
+	case *FaucetLimitError:
+		return &APIError{Code: ErrCodeRateLimited, Message: e.Message, RetryAfter: e.RetryAfter}
+	case *RevertError:
+		return NewAPIError(ErrCodeExecutionReverted, e.Error())
+	case *txservice.KeyError:
+		return NewAPIError(ErrCodeInvalidParam, e.Error())
+	}
+
+	message := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(message, "insufficient funds"):
+		return NewAPIError(ErrCodeInsufficientFunds, "insufficient funds for gas * price + value")
+	case strings.Contains(message, "nonce too low"),
+		strings.Contains(message, "nonce too high"),
+		strings.Contains(message, "replacement transaction underpriced"),
+		strings.Contains(message, "known transaction"),
+		strings.Contains(message, "already known"):
+		return NewAPIError(ErrCodeNonceConflict, err.Error())
+	}
+	if _, ok := err.(rpc.Error); ok {
+		return NewAPIError(ErrCodeTransactionRejected, err.Error())
+	}
+	if isNodeUnavailable(err) {
+		log.Println("node unavailable", err)
+		return NewAPIError(ErrCodeNodeUnavailable, nodeUnavailableErrorMessage)
+	}
+	log.Println("internal error", err)
+	return NewAPIError(ErrCodeInternalError, internalErrorMessage)
+}
+
+func isNodeUnavailable(err error) bool {
+	switch err.(type) {
+	case net.Error, *url.Error:
+		return true
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF || err == context.DeadlineExceeded || err == rpc.ErrClientQuit {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "connection refused") || strings.Contains(message, "no such host")
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+// ReservedStatus is the status of the ethereum_transactions rows holding a faucet request or the value of a
+// handshake call while it is sent
+const ReservedStatus = -2
+
+var locksDao = dao.LocksDao{}
+
+type FaucetLimitError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (err *FaucetLimitError) Error() string {
+	return err.Message
+}
+
+// CheckFaucetLimit checks a faucet request against the history of ethereum_transactions
+func CheckFaucetLimit(limit param.FaucetLimit, network string, refType string, userID int64, toAddress string, amount float64) error {
+	if amount <= 0 {
+		return NewAPIError(ErrCodeInvalidParam, "amount must be greater than 0")
+	}
+	if limit.MaxAmount > 0 && amount > limit.MaxAmount {
+		return NewAPIError(ErrCodeInvalidParam, fmt.Sprintf("amount exceeds the maximum of %v per request", limit.MaxAmount))
+	}
+	now := time.Now()
+	if limit.UserCooldown > 0 {
+		lastTrans := ethereumTransactionsDao.GetLastByUser(network, refType, userID)
+		if lastTrans.ID > 0 {
+			nextTime := lastTrans.DateCreated.Add(time.Duration(limit.UserCooldown) * time.Second)
+			if nextTime.After(now) {
+				return &FaucetLimitError{Message: "user has requested too recently", RetryAfter: nextTime.Sub(now)}
+			}
+		}
+	}
+	if limit.AddressCooldown > 0 {
+		lastTrans := ethereumTransactionsDao.GetLastByToAddress(network, refType, toAddress)
+		if lastTrans.ID > 0 {
+			nextTime := lastTrans.DateCreated.Add(time.Duration(limit.AddressCooldown) * time.Second)
+			if nextTime.After(now) {
+				return &FaucetLimitError{Message: "to_address has received too recently", RetryAfter: nextTime.Sub(now)}
+			}
+		}
+	}
+	if limit.DailyRequests > 0 || limit.DailyAmount > 0 {
+		count, total, err := ethereumTransactionsDao.GetStatsByUser(network, refType, userID, now.Add(-24*time.Hour))
+		if err != nil {
+			return err
+		}
+		if limit.DailyRequests > 0 && count >= limit.DailyRequests {
+			return &FaucetLimitError{Message: fmt.Sprintf("daily limit of %d requests is reached", limit.DailyRequests)}
+		}
+		if limit.DailyAmount > 0 && total+amount > limit.DailyAmount {
+			return &FaucetLimitError{Message: fmt.Sprintf("daily limit of %v is reached, %v remaining", limit.DailyAmount, limit.DailyAmount-total)}
+		}
+	}
+	return nil
+}
+
+// ReserveFaucet checks a faucet request and stores a reservation counted by the next checks. The checks of a user
+// and of an address are serialized by database locks so concurrent requests can not pass the limits together.
+func ReserveFaucet(limit param.FaucetLimit, network string, refType string, userID int64, toAddress string, amount float64) (models.EthereumTransactions, error) {
+	reservation := models.EthereumTransactions{}
+	tx := models.Database().Begin()
+	defer tx.Rollback()
+	names := []string{
+		faucetLockName(network, refType, "user", strconv.FormatInt(userID, 10)),
+		faucetLockName(network, refType, "address", strings.ToLower(toAddress)),
+	}
+	for _, name := range names {
+		acquired, err := locksDao.Acquire(tx, name, 10)
+		if err != nil {
+			return reservation, err
+		}
+		if !acquired {
+			return reservation, &FaucetLimitError{Message: "a faucet request is already in progress", RetryAfter: time.Second}
+		}
+		defer locksDao.Release(tx, name)
+	}
+
+	err := CheckFaucetLimit(limit, network, refType, userID, toAddress, amount)
+	if err != nil {
+		return reservation, err
+	}
+	return ethereumTransactionsDao.Create(models.EthereumTransactions{
+		UserID:    userID,
+		Network:   network,
+		RefType:   refType,
+		RefID:     userID,
+		ToAddress: toAddress,
+		Value:     amount,
+		Status:    ReservedStatus,
+	}, nil)
+}
+
+// ReleaseFaucet removes a reservation, the faucet transaction is recorded in its own row once it is broadcast
+func ReleaseFaucet(reservation models.EthereumTransactions) error {
+	_, err := ethereumTransactionsDao.Delete(reservation, nil)
+	return err
+}
+
+// FaucetTokenRefType is the ref type of the faucet payouts of token, the limits are counted per token since the
+// amounts of tokens with different units can not be summed. The default token of the network keeps user_free_token.
+func FaucetTokenRefType(network param.Network, token param.Token) string {
+	if strings.EqualFold(token.Address, network.TokenAddress) {
+		return "user_free_token"
+	}
+	return "user_free_token_" + strings.ToLower(token.Address)
+}
+
+func faucetLockName(network string, refType string, kind string, value string) string {
+	return lockName("faucet", network+":"+refType+":"+kind+":"+value)
+}
+
+// lockName keeps the lock names under the 64 characters of MySQL
+func lockName(prefix string, key string) string {
+	sum := sha1.Sum([]byte(key))
+	return prefix + ":" + hex.EncodeToString(sum[:])
+}
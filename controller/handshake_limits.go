@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+// handshakeContracts share the daily value of param.HandshakeLimits
+var handshakeContracts = []string{param.CONTRACT_PAYABLE, param.CONTRACT_CROWDSALE}
+
+// CheckHandshakeValue checks the ether attached to a handshake call of a user against the history of ethereum_transactions
+func CheckHandshakeValue(limits param.HandshakeLimits, network string, userID int64, value *big.Int) error {
+	if value.Sign() <= 0 {
+		return nil
+	}
+	if limits.DailyValue <= 0 {
+		return NewAPIError(ErrCodeForbidden, "ether can not be attached to handshakes on "+network)
+	}
+	amount := AmountToFloat(value, 18)
+	if limits.MaxValue > 0 && amount > limits.MaxValue {
+		return NewAPIError(ErrCodeInvalidParam, fmt.Sprintf("value exceeds the maximum of %v per call", limits.MaxValue))
+	}
+	total, err := ethereumTransactionsDao.GetValueByUser(network, handshakeContracts, userID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	if total+amount > limits.DailyValue {
+		return &FaucetLimitError{Message: fmt.Sprintf("daily value of %v is reached, %v remaining", limits.DailyValue, limits.DailyValue-total)}
+	}
+	return nil
+}
+
+// ReserveHandshakeValue checks the ether attached to a handshake call and stores a reservation counted by the next
+// checks while the call is sent, the checks of a user are serialized like in ReserveFaucet. Nothing is reserved
+// when no ether is attached.
+func ReserveHandshakeValue(limits param.HandshakeLimits, network string, contract string, method string, userID int64, value *big.Int) (models.EthereumTransactions, error) {
+	reservation := models.EthereumTransactions{}
+	if value.Sign() <= 0 {
+		return reservation, nil
+	}
+	tx := models.Database().Begin()
+	defer tx.Rollback()
+	name := lockName("handshake", network+":"+strconv.FormatInt(userID, 10))
+	acquired, err := locksDao.Acquire(tx, name, 10)
+	if err != nil {
+		return reservation, err
+	}
+	if !acquired {
+		return reservation, &FaucetLimitError{Message: "a handshake call is already in progress", RetryAfter: time.Second}
+	}
+	defer locksDao.Release(tx, name)
+
+	err = CheckHandshakeValue(limits, network, userID, value)
+	if err != nil {
+		return reservation, err
+	}
+	return ethereumTransactionsDao.Create(models.EthereumTransactions{
+		UserID:   userID,
+		Network:  network,
+		Contract: contract,
+		RefType:  contract + "_" + method,
+		Value:    AmountToFloat(value, 18),
+		Status:   ReservedStatus,
+	}, nil)
+}
+
+// ReleaseHandshakeValue removes a reservation, the call is recorded in its own row once it is broadcast
+func ReleaseHandshakeValue(reservation models.EthereumTransactions) error {
+	if reservation.ID <= 0 {
+		return nil
+	}
+	_, err := ethereumTransactionsDao.Delete(reservation, nil)
+	return err
+}
+
+// CheckHandshakeParty checks the user sent the transaction which inited or shook the handshake hid, the operator key
+// is the on-chain party of every user so the parties are the users of the indexed __init and __shake logs
+func CheckHandshakeParty(network string, chainID int, contractAddress string, hid *big.Int, userID int64) error {
+	ethereumLogs, err := ethereumLogsDao.GetListByHid(chainID, contractAddress, hid.String())
+	if err != nil {
+		return err
+	}
+	if len(ethereumLogs) == 0 {
+		return NewAPIError(ErrCodeNotFound, "handshake is not found")
+	}
+	for _, ethereumLog := range ethereumLogs {
+		if ethereumLog.Event != "__init" && ethereumLog.Event != "__shake" {
+			continue
+		}
+		ethTrans := ethereumTransactionsDao.GetByHash(ethereumLog.Hash)
+		if ethTrans.Network == network && ethTrans.UserID == userID {
+			return nil
+		}
+	}
+	return NewAPIError(ErrCodeForbidden, "user is not a party of the handshake")
+}
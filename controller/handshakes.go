@@ -0,0 +1,376 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+var (
+	handshakesDao = dao.HandshakesDao{}
+	// projectionMutex serializes the rebuilds so a rebuild never overwrites one which saw more logs
+	projectionMutex = sync.Mutex{}
+)
+
+// handshakeStates are the states entered by the events of the handshake contracts
+var handshakeStates = map[string]map[string]string{
+	param.CONTRACT_PAYABLE: {
+		"__init":     "inited",
+		"__shake":    "shaked",
+		"__deliver":  "delivered",
+		"__accept":   "accepted",
+		"__reject":   "rejected",
+		"__withdraw": "withdrawn",
+		"__cancel":   "cancelled",
+	},
+	param.CONTRACT_CROWDSALE: {
+		"__init":     "inited",
+		"__shake":    "shaked",
+		"__unshake":  "unshaked",
+		"__cancel":   "cancelled",
+		"__stop":     "stopped",
+		"__refund":   "refunded",
+		"__withdraw": "withdrawn",
+	},
+}
+
+// isHandshakeParty reports whether one of the __init and __shake logs was sent by a transaction of the user
+func isHandshakeParty(ethereumLogs []models.EthereumLogs, userID int64) bool {
+	for _, ethereumLog := range ethereumLogs {
+		if ethereumLog.Event != "__init" && ethereumLog.Event != "__shake" {
+			continue
+		}
+		if ethereumTransactionsDao.GetByHash(ethereumLog.Hash).UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHandshakeContract reports whether the logs of contract are projected to the handshakes table
+func IsHandshakeContract(contract string) bool {
+	_, ok := handshakeStates[contract]
+	return ok
+}
+
+func GetHandshakes(filter dao.HandshakesFilter) ([]models.Handshakes, error) {
+	return handshakesDao.GetListByFilter(filter)
+}
+
+// ResolveHandshakeContract returns the address of contract on chainID, contract is an address or the name of an agr
+func ResolveHandshakeContract(chainID int, contract string) (string, error) {
+	if common.IsHexAddress(contract) {
+		return strings.ToLower(contract), nil
+	}
+	for _, agr := range param.Conf.Agrs {
+		if agr.ChainID == chainID && agr.Contract == contract {
+			return strings.ToLower(agr.ContractAddress), nil
+		}
+	}
+	return "", NewAPIError(ErrCodeInvalidParam, "contract is invalid")
+}
+
+// GetHandshake returns the projected handshake and the logs it was built from, a handshake the user did not
+// initiate or shake is not found
+func GetHandshake(chainID int, contractAddress string, hid *big.Int, userID int64) (models.Handshakes, []map[string]interface{}, error) {
+	history := []map[string]interface{}{}
+	handshake := handshakesDao.GetByHid(chainID, contractAddress, hid.String())
+	if handshake.ID <= 0 {
+		return handshake, history, NewAPIError(ErrCodeNotFound, "handshake is not found")
+	}
+	ethereumLogs, err := ethereumLogsDao.GetListByHid(chainID, contractAddress, hid.String())
+	if err != nil {
+		return handshake, history, err
+	}
+	if !isHandshakeParty(ethereumLogs, userID) {
+		return models.Handshakes{}, []map[string]interface{}{}, NewAPIError(ErrCodeNotFound, "handshake is not found")
+	}
+	for _, ethereumLog := range ethereumLogs {
+		data, err := decodeLogData(ethereumLog.Data)
+		if err != nil {
+			return handshake, history, err
+		}
+		history = append(history, map[string]interface{}{
+			"event":        ethereumLog.Event,
+			"state":        handshakeStates[handshake.Contract][ethereumLog.Event],
+			"from_address": ethereumLog.FromAddress,
+			"block_number": ethereumLog.BlockNumber,
+			"log_index":    ethereumLog.LogIndex,
+			"hash":         ethereumLog.Hash,
+			"data":         data,
+			"date_created": ethereumLog.DateCreated,
+		})
+	}
+	return handshake, history, nil
+}
+
+// ProjectHandshake applies a new stored log of hid to its handshakes row. The logs are processed concurrently so
+// a log may be stored after the ones emitted later, the row is rebuilt from all the logs of hid when the log was
+// emitted before its last transition, when the row does not exist yet or when the log was not stored.
+func (processer *LogsProcesser) ProjectHandshake(hid *big.Int, ethereumLog models.EthereumLogs) error {
+	projectionMutex.Lock()
+	defer projectionMutex.Unlock()
+
+	chainID := processer.Agr.ChainID
+	contractAddress := processer.Agr.ContractAddress
+	handshake := handshakesDao.GetByHid(chainID, contractAddress, hid.String())
+	if handshake.ID > 0 && ethereumLog.ID > 0 && (ethereumLog.BlockNumber > handshake.BlockNumber ||
+		ethereumLog.BlockNumber == handshake.BlockNumber && ethereumLog.LogIndex > handshake.LogIndex) {
+		err := processer.applyHandshakeLog(&handshake, ethereumLog)
+		if err != nil {
+			return err
+		}
+		_, err = handshakesDao.Update(handshake, nil)
+		return err
+	}
+
+	ethereumLogs, err := ethereumLogsDao.GetListByHid(chainID, contractAddress, hid.String())
+	if err != nil {
+		return err
+	}
+	if len(ethereumLogs) == 0 {
+		return nil
+	}
+	projected := models.Handshakes{
+		ID:              handshake.ID,
+		DateCreated:     handshake.DateCreated,
+		ChainID:         chainID,
+		Contract:        processer.Agr.Contract,
+		ContractAddress: contractAddress,
+		Hid:             hid.String(),
+		Balance:         "0",
+	}
+	for _, ethereumLog := range ethereumLogs {
+		err = processer.applyHandshakeLog(&projected, ethereumLog)
+		if err != nil {
+			return err
+		}
+	}
+
+	if projected.ID > 0 {
+		_, err = handshakesDao.Update(projected, nil)
+	} else {
+		_, err = handshakesDao.Create(projected, nil)
+	}
+	return err
+}
+
+// applyHandshakeLog applies the transition of a log to handshake
+func (processer *LogsProcesser) applyHandshakeLog(handshake *models.Handshakes, ethereumLog models.EthereumLogs) error {
+	state, ok := handshakeStates[handshake.Contract][ethereumLog.Event]
+	if !ok {
+		return nil
+	}
+	data, err := decodeLogData(ethereumLog.Data)
+	if err != nil {
+		return err
+	}
+	balance, ok := new(big.Int).SetString(handshake.Balance, 10)
+	if !ok {
+		balance = big.NewInt(0)
+	}
+
+	switch handshake.Contract {
+	case param.CONTRACT_PAYABLE:
+		switch ethereumLog.Event {
+		case "__init":
+			handshake.Payee = logAddress(data["payee"])
+			handshake.Payer = logAddress(data["payer"])
+			// logs stored before the payee was decoded are from init, which is sent by the payee
+			if handshake.Payee == "" {
+				handshake.Payee = ethereumLog.FromAddress
+			}
+			// initByPayer pays the handshake
+			value, err := processer.transactionValue(ethereumLog)
+			if err != nil {
+				return err
+			}
+			balance.Add(balance, value)
+		case "__shake":
+			if handshake.Payer == "" {
+				handshake.Payer = ethereumLog.FromAddress
+			}
+			value, err := processer.transactionValue(ethereumLog)
+			if err != nil {
+				return err
+			}
+			balance.Add(balance, value)
+		case "__accept", "__withdraw", "__cancel":
+			// the payment leaves the contract
+			balance.SetInt64(0)
+		}
+	case param.CONTRACT_CROWDSALE:
+		if stateCode, ok := data["state"].(float64); ok {
+			handshake.StateCode = int(stateCode)
+		}
+		switch ethereumLog.Event {
+		case "__init":
+			// the crowdsale is raised by its creator from many payers
+			handshake.Payee = ethereumLog.FromAddress
+		case "__shake", "__unshake":
+			if logBalance, ok := logAmount(data["balance"]); ok {
+				balance = logBalance
+			}
+		case "__withdraw":
+			if amount, ok := logAmount(data["amount"]); ok {
+				balance.Sub(balance, amount)
+				if balance.Sign() < 0 {
+					balance.SetInt64(0)
+				}
+			}
+		}
+	}
+
+	handshake.State = state
+	handshake.Balance = balance.String()
+	if offchain, ok := data["offchain"].(string); ok && offchain != "" {
+		handshake.Offchain = offchain
+	}
+	handshake.Event = ethereumLog.Event
+	handshake.Hash = ethereumLog.Hash
+	handshake.BlockNumber = ethereumLog.BlockNumber
+	handshake.LogIndex = ethereumLog.LogIndex
+	return nil
+}
+
+// transactionValue returns the ether sent with the transaction of a log, the node is only called for
+// the logs stored before the value was recorded
+func (processer *LogsProcesser) transactionValue(ethereumLog models.EthereumLogs) (*big.Int, error) {
+	if value, ok := new(big.Int).SetString(ethereumLog.Value, 10); ok {
+		return value, nil
+	}
+	transaction, _, err := processer.Client.TransactionByHash(context.Background(), common.HexToHash(ethereumLog.Hash))
+	if err != nil {
+		return nil, err
+	}
+	return transaction.Value(), nil
+}
+
+// BackfillHandshakes decodes again the stored logs of a handshake contract from the receipts of their transactions,
+// the logs stored before the numbers were kept exact lost their precision, records the values
+// of their transactions and rebuilds the handshakes of every hid
+func (processer *LogsProcesser) BackfillHandshakes() error {
+	if !IsHandshakeContract(processer.Agr.Contract) {
+		return nil
+	}
+	hids := map[string]*big.Int{}
+	afterID := int64(0)
+	for {
+		ethereumLogs, err := ethereumLogsDao.GetListByContract(processer.Agr.ChainID, processer.Agr.ContractAddress, afterID, 500)
+		if err != nil {
+			return err
+		}
+		if len(ethereumLogs) == 0 {
+			break
+		}
+		for _, ethereumLog := range ethereumLogs {
+			afterID = ethereumLog.ID
+			ethereumLog, err = processer.backfillLog(ethereumLog)
+			if err != nil {
+				log.Println("LogsProcesser.BackfillHandshakes()", ethereumLog.Hash, err)
+				continue
+			}
+			data, err := decodeLogData(ethereumLog.Data)
+			if err != nil {
+				log.Println("LogsProcesser.BackfillHandshakes()", ethereumLog.Hash, err)
+				continue
+			}
+			if hid, ok := logAmount(data["hid"]); ok {
+				hids[hid.String()] = hid
+			}
+		}
+	}
+	for _, hid := range hids {
+		err := processer.ProjectHandshake(hid, models.EthereumLogs{})
+		if err != nil {
+			log.Println("LogsProcesser.BackfillHandshakes()", hid, err)
+		}
+	}
+	log.Println("LogsProcesser.BackfillHandshakes()", processer.Agr.ContractAddress, len(hids), "handshakes")
+	return nil
+}
+
+// backfillLog replaces the data of a stored log by the log of its transaction receipt decoded again and records
+// the value of its transaction
+func (processer *LogsProcesser) backfillLog(ethereumLog models.EthereumLogs) (models.EthereumLogs, error) {
+	event, ok := processer.Abi.Events[ethereumLog.Event]
+	if !ok {
+		return ethereumLog, errors.New("event " + ethereumLog.Event + " is not in the abi")
+	}
+	hash := common.HexToHash(ethereumLog.Hash)
+	receipt, err := processer.Client.TransactionReceipt(context.Background(), hash)
+	if err != nil {
+		return ethereumLog, err
+	}
+	var etherLog *types.Log
+	for _, receiptLog := range receipt.Logs {
+		if int64(receiptLog.Index) == ethereumLog.LogIndex && strings.EqualFold(receiptLog.Address.Hex(), ethereumLog.ContractAddress) {
+			etherLog = receiptLog
+			break
+		}
+	}
+	if etherLog == nil {
+		return ethereumLog, errors.New("log is not in the receipt")
+	}
+	data, err := processer.decodeLog(event, *etherLog)
+	if err != nil {
+		return ethereumLog, err
+	}
+	jsonStr, err := json.Marshal(data)
+	if err != nil {
+		return ethereumLog, err
+	}
+	ethereumLog.Data = string(jsonStr)
+	if ethereumLog.Value == "" {
+		transaction, _, err := processer.Client.TransactionByHash(context.Background(), hash)
+		if err != nil {
+			return ethereumLog, err
+		}
+		ethereumLog.Value = transaction.Value().String()
+	}
+	return ethereumLogsDao.Update(ethereumLog, nil)
+}
+
+// logAddress returns an address of the data of a log, the zero address is empty
+func logAddress(value interface{}) string {
+	str, ok := value.(string)
+	if !ok || !common.IsHexAddress(str) {
+		return ""
+	}
+	address := common.HexToAddress(str)
+	if address == (common.Address{}) {
+		return ""
+	}
+	return address.Hex()
+}
+
+// decodeLogData decodes the data of a stored log, the numbers are json.Number so the uint256 values keep their precision
+func decodeLogData(data string) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&result)
+	return result, err
+}
+
+// logAmount returns a uint256 value of the data of a log, MigrateData stores them as json numbers and DecodeLog
+// as decimal strings
+func logAmount(value interface{}) (*big.Int, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return new(big.Int).SetString(v.String(), 10)
+	case string:
+		return new(big.Int).SetString(v, 10)
+	}
+	return nil, false
+}
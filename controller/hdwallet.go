@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/hdwallet"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+var hdWalletsDao = dao.HDWalletsDao{}
+
+// HDBasePath returns the path the index of the user is appended to, m/44'/60'/0'/0 when none is configured
+func HDBasePath(conf param.HDWalletConfig, network param.Network) (accounts.DerivationPath, error) {
+	path := network.HDBasePath
+	if path == "" {
+		path = conf.BasePath
+	}
+	if path == "" {
+		return accounts.DefaultRootDerivationPath, nil
+	}
+	return accounts.ParseDerivationPath(path)
+}
+
+// GetDepositAddress returns the deposit address of the user on network, it is derived and stored on the first call
+func GetDepositAddress(wallet *hdwallet.Wallet, network string, basePath accounts.DerivationPath, userID int64) (models.HDWallets, error) {
+	hdWallet := hdWalletsDao.GetByUser(network, userID)
+	if hdWallet.ID > 0 {
+		return hdWallet, WatchAddress(network, userID, hdWallet.Address)
+	}
+	path, err := hdwallet.UserPath(basePath, userID)
+	if err != nil {
+		return hdWallet, NewAPIError(ErrCodeInvalidParam, err.Error())
+	}
+	privateKey, err := wallet.Derive(path)
+	if err != nil {
+		return hdWallet, err
+	}
+	hdWallet = models.HDWallets{
+		UserID:          userID,
+		Network:         network,
+		DerivationPath:  path.String(),
+		DerivationIndex: userID,
+		Address:         crypto.PubkeyToAddress(privateKey.PublicKey).Hex(),
+	}
+	created, err := hdWalletsDao.Create(hdWallet, nil)
+	if err != nil {
+		// a concurrent request stored it first
+		existing := hdWalletsDao.GetByUser(network, userID)
+		if existing.ID > 0 {
+			return existing, WatchAddress(network, userID, existing.Address)
+		}
+		return hdWallet, err
+	}
+	return created, WatchAddress(network, userID, created.Address)
+}
+
+// HDKeySource signs for the deposit addresses of a network in the txservice pipeline
+type HDKeySource struct {
+	Network string
+	Wallet  *hdwallet.Wallet
+}
+
+func (source HDKeySource) PrivateKey(address common.Address) (*ecdsa.PrivateKey, error) {
+	hdWallet := hdWalletsDao.GetByAddress(source.Network, address.Hex())
+	if hdWallet.ID <= 0 {
+		return nil, NewAPIError(ErrCodeNotFound, "address "+address.Hex()+" is not a deposit address")
+	}
+	// the stored path is used so the keys do not change with the configured base path
+	path, err := accounts.ParseDerivationPath(hdWallet.DerivationPath)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := source.Wallet.Derive(path)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.PubkeyToAddress(privateKey.PublicKey) != address {
+		return nil, NewAPIError(ErrCodeInternalError, "deposit address "+address.Hex()+" does not match the wallet")
+	}
+	return privateKey, nil
+}
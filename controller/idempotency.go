@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+var idempotencyKeysDao = dao.IdempotencyKeysDao{}
+
+func IdempotencyRetention() time.Duration {
+	if param.Conf.IdempotencyRetention <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(param.Conf.IdempotencyRetention) * time.Second
+}
+
+// BeginIdempotentRequest returns the stored result when the key was already used for the same request,
+// otherwise it reserves the key until FinishIdempotentRequest is called
+func BeginIdempotentRequest(userID int64, key string, fingerprint string) (models.IdempotencyKeys, bool, error) {
+	idempotencyKey := idempotencyKeysDao.GetByKey(userID, key)
+	if idempotencyKey.ID > 0 && idempotencyKey.DateCreated.Before(time.Now().Add(-IdempotencyRetention())) {
+		_, err := idempotencyKeysDao.Delete(idempotencyKey, nil)
+		if err != nil {
+			return idempotencyKey, false, err
+		}
+		idempotencyKey = models.IdempotencyKeys{}
+	}
+	if idempotencyKey.ID > 0 {
+		if idempotencyKey.Fingerprint != fingerprint {
+			return idempotencyKey, false, NewAPIError(ErrCodeIdempotencyConflict, "Idempotency-Key was already used for a different request")
+		}
+		if idempotencyKey.StatusCode == 0 {
+			return idempotencyKey, false, NewAPIError(ErrCodeIdempotencyConflict, "a request with this Idempotency-Key is in progress")
+		}
+		return idempotencyKey, true, nil
+	}
+
+	idempotencyKey.UserID = userID
+	idempotencyKey.Key = key
+	idempotencyKey.Fingerprint = fingerprint
+	idempotencyKey, err := idempotencyKeysDao.Create(idempotencyKey, nil)
+	if err != nil {
+		// the key is unique per user, a concurrent retry has reserved it first
+		return idempotencyKey, false, NewAPIError(ErrCodeIdempotencyConflict, "a request with this Idempotency-Key is in progress")
+	}
+	return idempotencyKey, false, nil
+}
+
+// FinishIdempotentRequest stores the response of a request. A response with the hash of a broadcast transaction
+// keeps the key whatever its status, failed requests which sent nothing release the key so they can be retried.
+func FinishIdempotentRequest(idempotencyKey models.IdempotencyKeys, statusCode int, response []byte) error {
+	result := struct {
+		Status int `json:"status"`
+		Data   struct {
+			Hash   string   `json:"hash"`
+			Hashes []string `json:"hashes"`
+		} `json:"data"`
+	}{}
+	err := json.Unmarshal(response, &result)
+	if err != nil {
+		log.Println("FinishIdempotentRequest", err)
+	}
+	broadcast := result.Data.Hash != "" || len(result.Data.Hashes) > 0
+	if !broadcast && result.Status != 1 {
+		return ReleaseIdempotentRequest(idempotencyKey)
+	}
+	idempotencyKey.StatusCode = statusCode
+	idempotencyKey.Response = string(response)
+	idempotencyKey.Hash = result.Data.Hash
+	_, err = idempotencyKeysDao.Update(idempotencyKey, nil)
+	return err
+}
+
+// ReleaseIdempotentRequest removes the reservation of a key so the request can be retried
+func ReleaseIdempotentRequest(idempotencyKey models.IdempotencyKeys) error {
+	_, err := idempotencyKeysDao.Delete(idempotencyKey, nil)
+	return err
+}
+
+func CleanIdempotencyKeys() error {
+	return idempotencyKeysDao.DeleteBefore(time.Now().Add(-IdempotencyRetention()), nil)
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+// TokenAgrs returns the agrs indexing the Transfer and Approval logs of the tokens of the networks with token_logs enabled,
+// the tokens already listed in agrs are skipped. The chain id is read from the node when the network does not set it and
+// the logs of a token without start_block are indexed from the head at the first start, the scan resumes from the last
+// page scanned after a restart.
+func TokenAgrs(agrs []param.Agr, networks map[string]param.Network) ([]param.Agr, error) {
+	indexed := map[string]bool{}
+	for _, agr := range agrs {
+		indexed[strings.ToLower(agr.ContractAddress)] = true
+	}
+	tokenAgrs := []param.Agr{}
+	for _, network := range networks {
+		if !network.TokenLogs.Enabled {
+			continue
+		}
+		client, err := ethclient.Dial(network.NetworkURL)
+		if err != nil {
+			return tokenAgrs, err
+		}
+		chainID, err := NetworkChainID(client, network)
+		if err != nil {
+			return tokenAgrs, err
+		}
+		header, err := client.HeaderByNumber(context.Background(), nil)
+		if err != nil {
+			return tokenAgrs, err
+		}
+		maxBlocks := network.TokenLogs.MaxBlocks
+		if maxBlocks <= 0 {
+			maxBlocks = 5000
+		}
+		for _, token := range network.GetTokens() {
+			if token.Address == "" || indexed[strings.ToLower(token.Address)] {
+				continue
+			}
+			indexed[strings.ToLower(token.Address)] = true
+			startBlock := token.StartBlock
+			if startBlock <= 0 {
+				startBlock = header.Number.Int64()
+			}
+			tokenAgrs = append(tokenAgrs, param.Agr{
+				ChainID:         int(chainID.Int64()),
+				ChainNetwork:    network.NetworkURL,
+				Contract:        param.CONTRACT_ERC20,
+				ContractAddress: token.Address,
+				TopicName:       network.TokenLogs.TopicName,
+				StartBlock:      startBlock,
+				MaxBlocks:       maxBlocks,
+			})
+		}
+	}
+	return tokenAgrs, nil
+}
+
+// DecodeLog decodes the indexed and non indexed arguments of a log of event, it is used for the
+// contracts without an entry in param.ABI_STRUCTS. Numbers are decimal strings and bytes are hex.
+func DecodeLog(event abi.Event, etherLog types.Log) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	topics := etherLog.Topics
+	if !event.Anonymous {
+		if len(topics) == 0 {
+			return result, errors.New("log of event " + event.Name + " has no topics")
+		}
+		topics = topics[1:]
+	}
+
+	indexed := 0
+	for _, input := range event.Inputs {
+		if !input.Indexed {
+			continue
+		}
+		if indexed >= len(topics) {
+			return result, errors.New("log of event " + event.Name + " misses indexed arguments")
+		}
+		topic := topics[indexed]
+		indexed++
+		switch input.Type.T {
+		case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy:
+			// dynamic indexed arguments are hashed
+			result[input.Name] = strings.ToLower(topic.Hex())
+			continue
+		}
+		argument := input
+		argument.Indexed = false
+		values, err := abi.Arguments{argument}.UnpackValues(topic.Bytes())
+		if err != nil {
+			return result, err
+		}
+		result[input.Name] = logValue(values[0])
+	}
+
+	nonIndexed := event.Inputs.NonIndexed()
+	if len(nonIndexed) > 0 {
+		values, err := nonIndexed.UnpackValues(etherLog.Data)
+		if err != nil {
+			return result, err
+		}
+		for i, input := range nonIndexed {
+			result[input.Name] = logValue(values[i])
+		}
+	}
+	return result, nil
+}
+
+func logValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case common.Address:
+		return strings.ToLower(v.Hex())
+	case common.Hash:
+		return strings.ToLower(v.Hex())
+	case []byte:
+		return hexutil.Encode(v)
+	case [32]byte:
+		return hexutil.Encode(v[:])
+	}
+	return value
+}
@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+const MetaTxRefType = "meta_tx"
+
+var (
+	metaTransactionsDao = dao.MetaTransactionsDao{}
+
+	eip712DomainTypeHash   = crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	forwardRequestTypeHash = crypto.Keccak256([]byte("ForwardRequest(address from,address to,uint256 value,uint256 gas,uint256 nonce,bytes data)"))
+	// execute(ForwardRequest,bytes) takes a tuple which the abi package can not pack, it is encoded by PackForwarderExecute
+	forwarderExecuteSelector = crypto.Keccak256([]byte("execute((address,address,uint256,uint256,uint256,bytes),bytes)"))[:4]
+	forwarderAbi             = `[{"constant":true,"inputs":[{"name":"from","type":"address"}],"name":"getNonce","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"}]`
+)
+
+// MetaTxRequest is the ForwardRequest signed by the user
+type MetaTxRequest struct {
+	From  common.Address
+	To    common.Address
+	Value *big.Int
+	Gas   uint64
+	Nonce uint64
+	Data  []byte
+}
+
+// MetaTxDomain returns the EIP-712 domain name and version of the relayer
+func MetaTxDomain(conf param.MetaTxConfig) (string, string) {
+	name := conf.DomainName
+	if name == "" {
+		name = "MinimalForwarder"
+	}
+	version := conf.DomainVersion
+	if version == "" {
+		version = "0.0.1"
+	}
+	return name, version
+}
+
+// MetaTxContracts returns the contracts the intents may call
+func MetaTxContracts(conf param.MetaTxConfig) []string {
+	if len(conf.Contracts) == 0 {
+		return []string{param.CONTRACT_PAYABLE, param.CONTRACT_CROWDSALE}
+	}
+	return conf.Contracts
+}
+
+// MetaTxHash returns the EIP-712 hash the user signs for req
+func MetaTxHash(conf param.MetaTxConfig, chainID *big.Int, verifyingContract common.Address, req MetaTxRequest) []byte {
+	name, version := MetaTxDomain(conf)
+	domainSeparator := crypto.Keccak256(
+		eip712DomainTypeHash,
+		crypto.Keccak256([]byte(name)),
+		crypto.Keccak256([]byte(version)),
+		math.PaddedBigBytes(chainID, 32),
+		common.LeftPadBytes(verifyingContract.Bytes(), 32),
+	)
+	structHash := crypto.Keccak256(
+		forwardRequestTypeHash,
+		common.LeftPadBytes(req.From.Bytes(), 32),
+		common.LeftPadBytes(req.To.Bytes(), 32),
+		math.PaddedBigBytes(req.Value, 32),
+		math.PaddedBigBytes(new(big.Int).SetUint64(req.Gas), 32),
+		math.PaddedBigBytes(new(big.Int).SetUint64(req.Nonce), 32),
+		crypto.Keccak256(req.Data),
+	)
+	return crypto.Keccak256([]byte("\x19\x01"), domainSeparator, structHash)
+}
+
+// RecoverMetaTxSigner returns the address which signed hash, v may be given as 0/1 or 27/28
+func RecoverMetaTxSigner(hash []byte, signature []byte) (common.Address, error) {
+	if len(signature) != 65 {
+		return common.Address{}, NewAPIError(ErrCodeInvalidParam, "signature is invalid")
+	}
+	sig := make([]byte, 65)
+	copy(sig, signature)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	publicKey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, NewAPIError(ErrCodeInvalidParam, "signature is invalid")
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+// MetaTxNonce returns the next nonce of from read from the forwarder
+func MetaTxNonce(client *ethclient.Client, conf param.MetaTxConfig, from common.Address) (uint64, error) {
+	forwarder, err := abi.JSON(strings.NewReader(forwarderAbi))
+	if err != nil {
+		return 0, err
+	}
+	data, err := forwarder.Pack("getNonce", from)
+	if err != nil {
+		return 0, err
+	}
+	forwarderAddress := common.HexToAddress(conf.Forwarder)
+	output, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &forwarderAddress, Data: data}, nil)
+	if err != nil {
+		return 0, err
+	}
+	nonce := new(big.Int)
+	err = forwarder.Unpack(&nonce, "getNonce", output)
+	if err != nil {
+		return 0, err
+	}
+	return nonce.Uint64(), nil
+}
+
+// MetaTxRelayerKey returns the key relaying the intents of a network. The contracts are only called through
+// a forwarder, which passes the user as the sender, and the relayer never signs with the key of the network.
+func MetaTxRelayerKey(networkID string, network param.Network) (*ecdsa.PrivateKey, error) {
+	conf := network.MetaTx
+	if !common.IsHexAddress(conf.Forwarder) {
+		return nil, NewAPIError(ErrCodeForbidden, "meta transactions need a forwarder on "+networkID)
+	}
+	if conf.PrivateKey == "" {
+		return nil, NewAPIError(ErrCodeForbidden, "meta transactions need a relayer key on "+networkID)
+	}
+	relayerKey, err := crypto.HexToECDSA(conf.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if network.PrivateKey != "" {
+		operatorKey, err := crypto.HexToECDSA(network.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		if crypto.PubkeyToAddress(operatorKey.PublicKey) == crypto.PubkeyToAddress(relayerKey.PublicKey) {
+			return nil, NewAPIError(ErrCodeForbidden, "the relayer key of "+networkID+" must not be the key of the network")
+		}
+	}
+	return relayerKey, nil
+}
+
+// CheckMetaTxQuota checks the gas relayed for the user in the last 24 hours leaves room for gas
+func CheckMetaTxQuota(conf param.MetaTxConfig, network string, userID int64, gas uint64) error {
+	used, err := ethereumTransactionsDao.GetGasByUser(network, MetaTxRefType, userID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	if uint64(used)+gas > conf.DailyGasQuota {
+		remaining := uint64(0)
+		if uint64(used) < conf.DailyGasQuota {
+			remaining = conf.DailyGasQuota - uint64(used)
+		}
+		return NewAPIError(ErrCodeRateLimited, fmt.Sprintf("daily gas quota of %d is reached, %d remaining", conf.DailyGasQuota, remaining))
+	}
+	return nil
+}
+
+// ReserveMetaTxQuota checks the quota of the user and stores a reservation of gas counted by the next checks
+// while the intent is relayed, the checks of a user are serialized like in ReserveFaucet
+func ReserveMetaTxQuota(conf param.MetaTxConfig, network string, userID int64, gas uint64) (models.EthereumTransactions, error) {
+	reservation := models.EthereumTransactions{}
+	tx := models.Database().Begin()
+	defer tx.Rollback()
+	name := lockName("meta_tx", network+":"+strconv.FormatInt(userID, 10))
+	acquired, err := locksDao.Acquire(tx, name, 10)
+	if err != nil {
+		return reservation, err
+	}
+	if !acquired {
+		return reservation, &FaucetLimitError{Message: "a meta transaction is already in progress", RetryAfter: time.Second}
+	}
+	defer locksDao.Release(tx, name)
+
+	err = CheckMetaTxQuota(conf, network, userID, gas)
+	if err != nil {
+		return reservation, err
+	}
+	return ethereumTransactionsDao.Create(models.EthereumTransactions{
+		UserID:  userID,
+		Network: network,
+		RefType: MetaTxRefType,
+		Gas:     float64(gas),
+		Status:  ReservedStatus,
+	}, nil)
+}
+
+// ReleaseMetaTxQuota removes a reservation, the relayed intent is recorded in its own row once it is broadcast
+func ReleaseMetaTxQuota(reservation models.EthereumTransactions) error {
+	if reservation.ID <= 0 {
+		return nil
+	}
+	_, err := ethereumTransactionsDao.Delete(reservation, nil)
+	return err
+}
+
+// PackForwarderExecute encodes the execute(ForwardRequest,bytes) call of the forwarder
+func PackForwarderExecute(req MetaTxRequest, signature []byte) []byte {
+	word := func(value *big.Int) []byte {
+		return math.PaddedBigBytes(value, 32)
+	}
+	padded := func(data []byte) []byte {
+		result := word(big.NewInt(int64(len(data))))
+		result = append(result, data...)
+		if len(data)%32 != 0 {
+			result = append(result, make([]byte, 32-len(data)%32)...)
+		}
+		return result
+	}
+
+	// the tuple has 5 static fields and the offset of data
+	request := []byte{}
+	request = append(request, common.LeftPadBytes(req.From.Bytes(), 32)...)
+	request = append(request, common.LeftPadBytes(req.To.Bytes(), 32)...)
+	request = append(request, word(req.Value)...)
+	request = append(request, word(new(big.Int).SetUint64(req.Gas))...)
+	request = append(request, word(new(big.Int).SetUint64(req.Nonce))...)
+	request = append(request, word(big.NewInt(6*32))...)
+	request = append(request, padded(req.Data)...)
+
+	data := append([]byte{}, forwarderExecuteSelector...)
+	data = append(data, word(big.NewInt(2*32))...)
+	data = append(data, word(big.NewInt(int64(2*32+len(request))))...)
+	data = append(data, request...)
+	data = append(data, padded(signature)...)
+	return data
+}
+
+// ReserveMetaTransaction stores the intent before it is sent so its nonce can not be relayed twice
+func ReserveMetaTransaction(metaTrans models.MetaTransactions) (models.MetaTransactions, error) {
+	metaTrans, err := metaTransactionsDao.Create(metaTrans, nil)
+	if dao.IsDuplicateKey(err) {
+		return metaTrans, NewAPIError(ErrCodeNonceConflict, "nonce is already used")
+	}
+	return metaTrans, err
+}
+
+// FinishMetaTransaction stores the hash of the relayed intent, an intent which was not sent releases its nonce
+func FinishMetaTransaction(metaTrans models.MetaTransactions, hash string) error {
+	if hash == "" {
+		_, err := metaTransactionsDao.Delete(metaTrans, nil)
+		return err
+	}
+	metaTrans.Hash = hash
+	_, err := metaTransactionsDao.Update(metaTrans, nil)
+	return err
+}
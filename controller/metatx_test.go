@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+var testMetaTxRequest = MetaTxRequest{
+	From:  common.HexToAddress("0x1000000000000000000000000000000000000001"),
+	To:    common.HexToAddress("0x3000000000000000000000000000000000000003"),
+	Value: big.NewInt(0),
+	Gas:   100000,
+	Nonce: 7,
+	Data:  []byte{0xde, 0xad, 0xbe, 0xef},
+}
+
+func TestMetaTxHash(t *testing.T) {
+	forwarder := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	hash := MetaTxHash(param.MetaTxConfig{}, big.NewInt(4), forwarder, testMetaTxRequest)
+	want := "0x2e6559897b4b4c0d2b55b5e81dd598288bb6554db131b9a33cb45082fabaa4eb"
+	if hexutil.Encode(hash) != want {
+		t.Errorf("hash %s, want %s", hexutil.Encode(hash), want)
+	}
+
+	// the domain and every field of the request are signed
+	nonceChanged := testMetaTxRequest
+	nonceChanged.Nonce++
+	dataChanged := testMetaTxRequest
+	dataChanged.Data = []byte{0xde, 0xad}
+	changed := map[string][]byte{
+		"domain name": MetaTxHash(param.MetaTxConfig{DomainName: "Forwarder"}, big.NewInt(4), forwarder, testMetaTxRequest),
+		"chain id":    MetaTxHash(param.MetaTxConfig{}, big.NewInt(1), forwarder, testMetaTxRequest),
+		"forwarder":   MetaTxHash(param.MetaTxConfig{}, big.NewInt(4), testMetaTxRequest.To, testMetaTxRequest),
+		"nonce":       MetaTxHash(param.MetaTxConfig{}, big.NewInt(4), forwarder, nonceChanged),
+		"data":        MetaTxHash(param.MetaTxConfig{}, big.NewInt(4), forwarder, dataChanged),
+	}
+	for name, changedHash := range changed {
+		if hexutil.Encode(changedHash) == want {
+			t.Errorf("%s is not in the hash", name)
+		}
+	}
+}
+
+func TestRecoverMetaTxSigner(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+	hash := MetaTxHash(param.MetaTxConfig{}, big.NewInt(4), common.Address{}, testMetaTxRequest)
+	signature, err := crypto.Sign(hash, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	walletSignature := append([]byte{}, signature...)
+	walletSignature[64] += 27
+
+	tests := []struct {
+		name      string
+		hash      []byte
+		signature []byte
+		err       bool
+	}{
+		{"v 0/1", hash, signature, false},
+		{"v 27/28", hash, walletSignature, false},
+		{"short signature", hash, signature[:64], true},
+		{"invalid v", hash, append(append([]byte{}, signature[:64]...), 5), true},
+	}
+	for _, test := range tests {
+		signer, err := RecoverMetaTxSigner(test.hash, test.signature)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: signer %s, want an error", test.name, signer.Hex())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if signer != address {
+			t.Errorf("%s: signer %s, want %s", test.name, signer.Hex(), address.Hex())
+		}
+	}
+
+	// a signature of another request recovers another address
+	other := MetaTxHash(param.MetaTxConfig{}, big.NewInt(1), common.Address{}, testMetaTxRequest)
+	signer, err := RecoverMetaTxSigner(other, signature)
+	if err == nil && signer == address {
+		t.Error("signature of another hash recovers the signer")
+	}
+}
+
+func TestPackForwarderExecute(t *testing.T) {
+	signature := make([]byte, 65)
+	for i := range signature {
+		signature[i] = byte(i)
+	}
+	data := PackForwarderExecute(testMetaTxRequest, signature)
+	want := "0x47153f82" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"0000000000000000000000000000000000000000000000000000000000000140" +
+		"0000000000000000000000001000000000000000000000000000000000000001" +
+		"0000000000000000000000003000000000000000000000000000000000000003" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"00000000000000000000000000000000000000000000000000000000000186a0" +
+		"0000000000000000000000000000000000000000000000000000000000000007" +
+		"00000000000000000000000000000000000000000000000000000000000000c0" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"deadbeef00000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000041" +
+		"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f" +
+		"202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f" +
+		"4000000000000000000000000000000000000000000000000000000000000000"
+	if hexutil.Encode(data) != want {
+		t.Errorf("data %s, want %s", hexutil.Encode(data), want)
+	}
+}
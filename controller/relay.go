@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+)
+
+// DecodeRawTransaction decodes a RLP hex signed transaction
+func DecodeRawTransaction(raw string) (*types.Transaction, error) {
+	data, err := hexutil.Decode(raw)
+	if err != nil {
+		return nil, NewAPIError(ErrCodeInvalidParam, "raw is not a hex string")
+	}
+	tx := new(types.Transaction)
+	err = rlp.DecodeBytes(data, tx)
+	if err != nil {
+		return nil, NewAPIError(ErrCodeInvalidParam, "raw is not a signed transaction: "+err.Error())
+	}
+	return tx, nil
+}
+
+// NetworkChainID returns the configured chain id of the network, or the one of its node
+func NetworkChainID(client *ethclient.Client, network param.Network) (*big.Int, error) {
+	if network.ChainID > 0 {
+		return big.NewInt(network.ChainID), nil
+	}
+	return client.NetworkID(context.Background())
+}
+
+// CheckRelayLimits checks a signed transaction can be relayed on the network of chainID
+func CheckRelayLimits(limits param.RelayLimits, chainID *big.Int, tx *types.Transaction) error {
+	if !tx.Protected() || tx.ChainId().Cmp(chainID) != 0 {
+		return NewAPIError(ErrCodeInvalidParam, fmt.Sprintf("transaction must be signed for chain id %s", chainID))
+	}
+	if tx.To() == nil {
+		return NewAPIError(ErrCodeInvalidParam, "contract creation is not relayed")
+	}
+	if limits.MaxGasPrice > 0 {
+		maxGasPrice, err := ParseAmount(strconv.FormatFloat(limits.MaxGasPrice, 'f', -1, 64), 9)
+		if err != nil {
+			return err
+		}
+		if tx.GasPrice().Cmp(maxGasPrice) > 0 {
+			return NewAPIError(ErrCodeInvalidParam, fmt.Sprintf("gas price exceeds the maximum of %v gwei", limits.MaxGasPrice))
+		}
+	}
+	if limits.MaxFee > 0 {
+		maxFee, err := ParseAmount(strconv.FormatFloat(limits.MaxFee, 'f', -1, 64), 18)
+		if err != nil {
+			return err
+		}
+		fee := new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(tx.Gas()))
+		if fee.Cmp(maxFee) > 0 {
+			return NewAPIError(ErrCodeInvalidParam, fmt.Sprintf("fee exceeds the maximum of %v ether", limits.MaxFee))
+		}
+	}
+	if len(limits.AllowedRecipients) > 0 {
+		allowed := false
+		for _, recipient := range limits.AllowedRecipients {
+			if strings.EqualFold(recipient, tx.To().Hex()) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return NewAPIError(ErrCodeForbidden, "to_address is not allowed")
+		}
+	}
+	return nil
+}
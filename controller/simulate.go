@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// Error(string) selector used by solidity for revert and require messages
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+type RevertError struct {
+	Reason string
+}
+
+func (err *RevertError) Error() string {
+	if err.Reason == "" {
+		return "execution reverted"
+	}
+	return "execution reverted: " + err.Reason
+}
+
+// DecodeRevertReason extracts the message of a reverted call output
+func DecodeRevertReason(output []byte) (string, bool) {
+	if len(output) < 4 || !bytes.Equal(output[:4], revertSelector) {
+		return "", false
+	}
+	stringType, err := abi.NewType("string")
+	if err != nil {
+		return "", false
+	}
+	var reason string
+	err = abi.Arguments{{Type: stringType}}.Unpack(&reason, output[4:])
+	if err != nil {
+		return "", false
+	}
+	return reason, true
+}
+
+// SimulateBackend is the part of an ethereum client used to simulate transactions
+type SimulateBackend interface {
+	PendingCallContract(ctx context.Context, call ethereum.CallMsg) ([]byte, error)
+	EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error)
+}
+
+// SimulateTransaction runs msg against the pending state without broadcasting it and returns the estimated gas
+func SimulateTransaction(client SimulateBackend, msg ethereum.CallMsg) (uint64, error) {
+	output, err := client.PendingCallContract(context.Background(), msg)
+	if err != nil {
+		return 0, err
+	}
+	if reason, ok := DecodeRevertReason(output); ok {
+		return 0, &RevertError{Reason: reason}
+	}
+	gas, err := client.EstimateGas(context.Background(), msg)
+	if err != nil {
+		return 0, err
+	}
+	return gas, nil
+}
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/txservice"
+)
+
+var userWalletsDao = dao.UserWalletsDao{}
+
+// EthereumTransactionView is a transaction returned by the history endpoints, models.EthereumTransactions
+// keeps its json names as POST /tx binds its body to it
+type EthereumTransactionView struct {
+	DateCreated  time.Time `json:"date_created"`
+	DateModified time.Time `json:"date_modified"`
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"user_id"`
+	Network      string    `json:"network"`
+	ChainID      int64     `json:"chain_id"`
+	Contract     string    `json:"contract"`
+	RefType      string    `json:"ref_type"`
+	RefID        int64     `json:"ref_id"`
+	Hash         string    `json:"hash"`
+	FromAddress  string    `json:"from_address"`
+	ToAddress    string    `json:"to_address"`
+	Gas          float64   `json:"gas"`
+	GasPrice     float64   `json:"gas_price"`
+	Value        float64   `json:"value"`
+	Nonce        int       `json:"nonce"`
+	Data         string    `json:"data"`
+	GasUsed      float64   `json:"gas_used"`
+	Status       int       `json:"status"`
+}
+
+func NewEthereumTransactionView(ethTrans models.EthereumTransactions) EthereumTransactionView {
+	return EthereumTransactionView(ethTrans)
+}
+
+func NewEthereumTransactionViews(ethTransList []models.EthereumTransactions) []EthereumTransactionView {
+	views := []EthereumTransactionView{}
+	for _, ethTrans := range ethTransList {
+		views = append(views, NewEthereumTransactionView(ethTrans))
+	}
+	return views
+}
+
+func GetEthereumTransactions(filter dao.EthereumTransactionsFilter) ([]models.EthereumTransactions, error) {
+	return ethereumTransactionsDao.GetListByFilter(filter)
+}
+
+func GetEthereumTransactionByHash(hash string) models.EthereumTransactions {
+	return ethereumTransactionsDao.GetByHash(hash)
+}
+
+// RefreshEthereumTransaction stores the receipt result of a pending transaction,
+// the returned receipt is nil while the transaction is not mined yet
+func RefreshEthereumTransaction(client *ethclient.Client, ethTrans models.EthereumTransactions) (models.EthereumTransactions, *types.Receipt, error) {
+	receipt, err := client.TransactionReceipt(context.Background(), common.HexToHash(ethTrans.Hash))
+	if err == ethereum.NotFound {
+		return ethTrans, nil, nil
+	}
+	if err != nil {
+		return ethTrans, nil, err
+	}
+	ethTrans.Status = int(receipt.Status)
+	ethTrans.GasUsed = float64(receipt.GasUsed)
+	ethTrans, err = ethereumTransactionsDao.Update(ethTrans, nil)
+	if err != nil {
+		return ethTrans, receipt, err
+	}
+	return ethTrans, receipt, nil
+}
+
+// VerifyEthereumTransaction looks the hash of ethTrans up on the network and fills the transaction fields from the chain,
+// the transaction must be mined or pending
+func VerifyEthereumTransaction(client *ethclient.Client, ethTrans models.EthereumTransactions) (models.EthereumTransactions, error) {
+	tx, _, err := client.TransactionByHash(context.Background(), common.HexToHash(ethTrans.Hash))
+	if err == ethereum.NotFound {
+		return ethTrans, NewAPIError(ErrCodeNotFound, "transaction is not found on "+ethTrans.Network)
+	}
+	if err != nil {
+		return ethTrans, err
+	}
+	return FillEthereumTransaction(ethTrans, tx)
+}
+
+// FillEthereumTransaction sets the fields of ethTrans decoded from the signed transaction, the sender of a
+// transaction with an invalid signature can not be recovered
+func FillEthereumTransaction(ethTrans models.EthereumTransactions, tx *types.Transaction) (models.EthereumTransactions, error) {
+	fromAddress, err := types.Sender(TransactionSigner(tx), tx)
+	if err != nil {
+		return ethTrans, NewAPIError(ErrCodeInvalidParam, "signature is invalid")
+	}
+
+	ethTrans.Hash = tx.Hash().Hex()
+	ethTrans.ChainID = tx.ChainId().Int64()
+	ethTrans.FromAddress = fromAddress.Hex()
+	ethTrans.ToAddress = ""
+	if tx.To() != nil {
+		ethTrans.ToAddress = tx.To().Hex()
+	}
+	ethTrans.Value = AmountToFloat(tx.Value(), 18)
+	ethTrans.Nonce = int(tx.Nonce())
+	ethTrans.Gas = float64(tx.Gas())
+	ethTrans.GasPrice = AmountToFloat(tx.GasPrice(), 0)
+	ethTrans.Data = ""
+	if len(tx.Data()) > 0 {
+		ethTrans.Data = hexutil.Encode(tx.Data())
+	}
+	return ethTrans, nil
+}
+
+// TransactionSigner returns the signer matching the signature of tx
+func TransactionSigner(tx *types.Transaction) types.Signer {
+	if tx.Protected() {
+		return types.NewEIP155Signer(tx.ChainId())
+	}
+	return types.HomesteadSigner{}
+}
+
+// IsUserWallet reports whether address is a wallet registered to the user
+func IsUserWallet(userID int64, address string) bool {
+	return userWalletsDao.GetByAddress(userID, address).ID > 0
+}
+
+// NewTxService returns the transaction service of a network, the transactions are simulated before they are
+// sent and recorded in ethereum_transactions
+func NewTxService(network string, backend txservice.Backend) *txservice.Service {
+	service := txservice.New(network, backend)
+	service.Recorder = CreateEthereumTransaction
+	service.Simulate = func(backend txservice.Backend, msg ethereum.CallMsg) (uint64, error) {
+		return SimulateTransaction(backend, msg)
+	}
+	return service
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+// TopUpRemaining returns the amount in the smallest unit the treasury may still send for refType, daily is the limit
+// of the last 24 hours
+func TopUpRemaining(network string, refType string, treasuryAddress string, daily float64, decimals int) (*big.Int, error) {
+	total, err := ethereumTransactionsDao.GetTotalByFromAddress(network, refType, treasuryAddress, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	dailyAmount, err := FloatToAmount(daily, decimals)
+	if err != nil {
+		return nil, err
+	}
+	totalAmount, err := FloatToAmount(total, decimals)
+	if err != nil {
+		return nil, err
+	}
+	return dailyAmount.Sub(dailyAmount, totalAmount), nil
+}
+
+// LastTopUp returns the last top-up sent to toAddress
+func LastTopUp(network string, refType string, toAddress string) models.EthereumTransactions {
+	return ethereumTransactionsDao.GetLastByToAddress(network, refType, toAddress)
+}
@@ -0,0 +1,88 @@
+package dao
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+type DepositsDao struct {
+}
+
+func (depositsDao DepositsDao) GetByLog(network string, hash string, logIndex int64) models.Deposits {
+	dto := models.Deposits{}
+	err := models.Database().Where("network = ? AND hash = ? AND log_index = ?", network, strings.ToLower(hash), logIndex).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (depositsDao DepositsDao) GetPending(network string) ([]models.Deposits, error) {
+	dtos := []models.Deposits{}
+	err := models.Database().Where("network = ? AND status = 0", network).Order("block_number asc").Find(&dtos).Error
+	if err != nil {
+		log.Println(err)
+		return dtos, err
+	}
+	return dtos, nil
+}
+
+func (depositsDao DepositsDao) Create(dto models.Deposits, tx *gorm.DB) (models.Deposits, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.Address = strings.ToLower(dto.Address)
+	dto.FromAddress = strings.ToLower(dto.FromAddress)
+	dto.TokenAddress = strings.ToLower(dto.TokenAddress)
+	dto.Hash = strings.ToLower(dto.Hash)
+	dto.DateCreated = time.Now()
+	dto.DateModified = dto.DateCreated
+	err := tx.Create(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (depositsDao DepositsDao) Update(dto models.Deposits, tx *gorm.DB) (models.Deposits, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.DateModified = time.Now()
+	err := tx.Save(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (depositsDao DepositsDao) GetScan(network string) models.DepositScans {
+	dto := models.DepositScans{}
+	err := models.Database().Where("network = ?", network).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (depositsDao DepositsDao) SaveScan(dto models.DepositScans, tx *gorm.DB) (models.DepositScans, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.DateModified = time.Now()
+	if dto.ID <= 0 {
+		dto.DateCreated = dto.DateModified
+	}
+	err := tx.Save(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
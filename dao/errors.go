@@ -0,0 +1,11 @@
+package dao
+
+import (
+	"github.com/go-sql-driver/mysql"
+)
+
+// IsDuplicateKey reports whether err is the violation of a unique key by an insert
+func IsDuplicateKey(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == 1062
+}
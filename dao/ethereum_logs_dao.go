@@ -30,6 +30,31 @@ func (contractLogsDao EthereumLogsDao) GetByFilter(contractAddress string, event
 	return dto
 }
 
+// GetListByHid returns the logs of a handshake in the order they were emitted, hid is decimal and
+// matches the logs storing it as a string or, before the backfill, as a number
+func (contractLogsDao EthereumLogsDao) GetListByHid(chainId int, contractAddress string, hid string) ([]models.EthereumLogs, error) {
+	contractAddress = strings.ToLower(contractAddress)
+	dtos := []models.EthereumLogs{}
+	err := models.Database().Where("chain_id = ? AND contract_address = ? AND JSON_UNQUOTE(JSON_EXTRACT(data, '$.hid')) = ?", chainId, contractAddress, hid).Order("block_number asc, log_index asc").Find(&dtos).Error
+	if err != nil {
+		log.Println(err)
+		return dtos, err
+	}
+	return dtos, nil
+}
+
+// GetListByContract returns limit logs of a contract after the log afterID in the order they were stored
+func (contractLogsDao EthereumLogsDao) GetListByContract(chainId int, contractAddress string, afterID int64, limit int) ([]models.EthereumLogs, error) {
+	contractAddress = strings.ToLower(contractAddress)
+	dtos := []models.EthereumLogs{}
+	err := models.Database().Where("chain_id = ? AND contract_address = ? AND id > ?", chainId, contractAddress, afterID).Order("id asc").Limit(limit).Find(&dtos).Error
+	if err != nil {
+		log.Println(err)
+		return dtos, err
+	}
+	return dtos, nil
+}
+
 func (contractLogsDao EthereumLogsDao) Create(dto models.EthereumLogs, tx *gorm.DB) (models.EthereumLogs, error) {
 	if tx == nil {
 		tx = models.Database()
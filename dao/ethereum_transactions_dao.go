@@ -11,6 +11,18 @@ import (
 type EthereumTransactionsDao struct {
 }
 
+type EthereumTransactionsFilter struct {
+	UserID   int64
+	Network  string
+	RefType  string
+	RefID    int64
+	Status   *int
+	FromDate *time.Time
+	ToDate   *time.Time
+	Cursor   int64
+	Limit    int
+}
+
 func (contractLogsDao EthereumTransactionsDao) GetById(id int64) (models.EthereumTransactions) {
 	dto := models.EthereumTransactions{}
 	err := models.Database().Where("id = ?", id).First(&dto).Error
@@ -40,6 +52,113 @@ func (contractLogsDao EthereumTransactionsDao) GetByFilter(contractAddress strin
 	return dto
 }
 
+func (contractLogsDao EthereumTransactionsDao) GetLastByUser(network string, refType string, userID int64) (models.EthereumTransactions) {
+	dto := models.EthereumTransactions{}
+	err := models.Database().Where("network = ? AND ref_type = ? AND user_id = ?", network, refType, userID).Order("date_created desc").First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (contractLogsDao EthereumTransactionsDao) GetLastByToAddress(network string, refType string, toAddress string) (models.EthereumTransactions) {
+	toAddress = strings.ToLower(toAddress)
+	dto := models.EthereumTransactions{}
+	err := models.Database().Where("network = ? AND ref_type = ? AND to_address = ?", network, refType, toAddress).Order("date_created desc").First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (contractLogsDao EthereumTransactionsDao) GetStatsByUser(network string, refType string, userID int64, since time.Time) (int64, float64, error) {
+	stats := struct {
+		Count int64
+		Total float64
+	}{}
+	err := models.Database().Model(&models.EthereumTransactions{}).Select("COUNT(*) AS count, COALESCE(SUM(value), 0) AS total").Where("network = ? AND ref_type = ? AND user_id = ? AND date_created >= ?", network, refType, userID, since).Scan(&stats).Error
+	if err != nil {
+		log.Println(err)
+		return 0, 0, err
+	}
+	return stats.Count, stats.Total, nil
+}
+
+// GetTotalByFromAddress sums the value of the transactions sent from fromAddress
+func (contractLogsDao EthereumTransactionsDao) GetTotalByFromAddress(network string, refType string, fromAddress string, since time.Time) (float64, error) {
+	fromAddress = strings.ToLower(fromAddress)
+	stats := struct {
+		Total float64
+	}{}
+	err := models.Database().Model(&models.EthereumTransactions{}).Select("COALESCE(SUM(value), 0) AS total").Where("network = ? AND ref_type = ? AND from_address = ? AND date_created >= ?", network, refType, fromAddress, since).Scan(&stats).Error
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return stats.Total, nil
+}
+
+// GetValueByUser sums the value attached to the calls of contracts sent for the user
+func (contractLogsDao EthereumTransactionsDao) GetValueByUser(network string, contracts []string, userID int64, since time.Time) (float64, error) {
+	stats := struct {
+		Total float64
+	}{}
+	err := models.Database().Model(&models.EthereumTransactions{}).Select("COALESCE(SUM(value), 0) AS total").Where("network = ? AND contract IN (?) AND user_id = ? AND date_created >= ?", network, contracts, userID, since).Scan(&stats).Error
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return stats.Total, nil
+}
+
+// GetGasByUser sums the gas used by the transactions of the user, the gas limit is counted while they are pending
+func (contractLogsDao EthereumTransactionsDao) GetGasByUser(network string, refType string, userID int64, since time.Time) (float64, error) {
+	stats := struct {
+		Total float64
+	}{}
+	err := models.Database().Model(&models.EthereumTransactions{}).Select("COALESCE(SUM(CASE WHEN gas_used > 0 THEN gas_used ELSE gas END), 0) AS total").Where("network = ? AND ref_type = ? AND user_id = ? AND date_created >= ?", network, refType, userID, since).Scan(&stats).Error
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return stats.Total, nil
+}
+
+func (contractLogsDao EthereumTransactionsDao) GetListByFilter(filter EthereumTransactionsFilter) ([]models.EthereumTransactions, error) {
+	dtos := []models.EthereumTransactions{}
+	query := models.Database().Where("user_id = ?", filter.UserID)
+	if filter.Network != "" {
+		query = query.Where("network = ?", filter.Network)
+	}
+	if filter.RefType != "" {
+		query = query.Where("ref_type = ?", filter.RefType)
+	}
+	if filter.RefID > 0 {
+		query = query.Where("ref_id = ?", filter.RefID)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	} else {
+		// the reservations of the faucet and handshake limits (controller.ReservedStatus) are not transactions
+		query = query.Where("status <> ?", -2)
+	}
+	if filter.FromDate != nil {
+		query = query.Where("date_created >= ?", *filter.FromDate)
+	}
+	if filter.ToDate != nil {
+		query = query.Where("date_created < ?", *filter.ToDate)
+	}
+	if filter.Cursor > 0 {
+		query = query.Where("id < ?", filter.Cursor)
+	}
+	err := query.Order("id desc").Limit(filter.Limit).Find(&dtos).Error
+	if err != nil {
+		log.Println(err)
+		return dtos, err
+	}
+	return dtos, nil
+}
+
 func (contractLogsDao EthereumTransactionsDao) Create(dto models.EthereumTransactions, tx *gorm.DB) (models.EthereumTransactions, error) {
 	if tx == nil {
 		tx = models.Database()
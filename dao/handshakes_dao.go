@@ -0,0 +1,117 @@
+package dao
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+type HandshakesDao struct {
+}
+
+// HandshakesFilter lists the handshakes matching every set field, Address matches the payer or the payee,
+// UserID matches the handshakes the user initiated or shook
+type HandshakesFilter struct {
+	UserID          int64
+	ChainID         int
+	Contract        string
+	ContractAddress string
+	State           string
+	Payer           string
+	Payee           string
+	Address         string
+	Offchain        string
+	Cursor          int64
+	Limit           int
+}
+
+func (handshakesDao HandshakesDao) GetByHid(chainID int, contractAddress string, hid string) models.Handshakes {
+	dto := models.Handshakes{}
+	err := models.Database().Where("chain_id = ? AND contract_address = ? AND hid = ?", chainID, strings.ToLower(contractAddress), hid).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (handshakesDao HandshakesDao) GetListByFilter(filter HandshakesFilter) ([]models.Handshakes, error) {
+	dtos := []models.Handshakes{}
+	query := models.Database()
+	if filter.UserID > 0 {
+		query = query.Where(`EXISTS (SELECT 1 FROM ethereum_logs JOIN ethereum_transactions ON ethereum_transactions.hash = ethereum_logs.hash
+			WHERE ethereum_logs.chain_id = handshakes.chain_id AND ethereum_logs.contract_address = handshakes.contract_address
+			AND ethereum_logs.event IN ('__init', '__shake') AND JSON_UNQUOTE(JSON_EXTRACT(ethereum_logs.data, '$.hid')) = handshakes.hid
+			AND ethereum_transactions.user_id = ?)`, filter.UserID)
+	}
+	if filter.ChainID > 0 {
+		query = query.Where("chain_id = ?", filter.ChainID)
+	}
+	if filter.Contract != "" {
+		query = query.Where("contract = ?", filter.Contract)
+	}
+	if filter.ContractAddress != "" {
+		query = query.Where("contract_address = ?", strings.ToLower(filter.ContractAddress))
+	}
+	if filter.State != "" {
+		query = query.Where("state = ?", filter.State)
+	}
+	if filter.Payer != "" {
+		query = query.Where("payer = ?", strings.ToLower(filter.Payer))
+	}
+	if filter.Payee != "" {
+		query = query.Where("payee = ?", strings.ToLower(filter.Payee))
+	}
+	if filter.Address != "" {
+		query = query.Where("payer = ? OR payee = ?", strings.ToLower(filter.Address), strings.ToLower(filter.Address))
+	}
+	if filter.Offchain != "" {
+		query = query.Where("offchain = ?", filter.Offchain)
+	}
+	if filter.Cursor > 0 {
+		query = query.Where("id < ?", filter.Cursor)
+	}
+	err := query.Order("id desc").Limit(filter.Limit).Find(&dtos).Error
+	if err != nil {
+		log.Println(err)
+		return dtos, err
+	}
+	return dtos, nil
+}
+
+func (handshakesDao HandshakesDao) Create(dto models.Handshakes, tx *gorm.DB) (models.Handshakes, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.ContractAddress = strings.ToLower(dto.ContractAddress)
+	dto.Payer = strings.ToLower(dto.Payer)
+	dto.Payee = strings.ToLower(dto.Payee)
+	dto.Hash = strings.ToLower(dto.Hash)
+	dto.DateCreated = time.Now()
+	dto.DateModified = dto.DateCreated
+	err := tx.Create(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (handshakesDao HandshakesDao) Update(dto models.Handshakes, tx *gorm.DB) (models.Handshakes, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.ContractAddress = strings.ToLower(dto.ContractAddress)
+	dto.Payer = strings.ToLower(dto.Payer)
+	dto.Payee = strings.ToLower(dto.Payee)
+	dto.Hash = strings.ToLower(dto.Hash)
+	dto.DateModified = time.Now()
+	err := tx.Save(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
@@ -0,0 +1,46 @@
+package dao
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+type HDWalletsDao struct {
+}
+
+func (hdWalletsDao HDWalletsDao) GetByUser(network string, userID int64) models.HDWallets {
+	dto := models.HDWallets{}
+	err := models.Database().Where("network = ? AND user_id = ?", network, userID).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (hdWalletsDao HDWalletsDao) GetByAddress(network string, address string) models.HDWallets {
+	dto := models.HDWallets{}
+	err := models.Database().Where("network = ? AND address = ?", network, strings.ToLower(address)).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (hdWalletsDao HDWalletsDao) Create(dto models.HDWallets, tx *gorm.DB) (models.HDWallets, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.Address = strings.ToLower(dto.Address)
+	dto.DateCreated = time.Now()
+	dto.DateModified = dto.DateCreated
+	err := tx.Create(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+type IdempotencyKeysDao struct {
+}
+
+func (idempotencyKeysDao IdempotencyKeysDao) GetByKey(userID int64, key string) models.IdempotencyKeys {
+	dto := models.IdempotencyKeys{}
+	err := models.Database().Where("user_id = ? AND `key` = ?", userID, key).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (idempotencyKeysDao IdempotencyKeysDao) Create(dto models.IdempotencyKeys, tx *gorm.DB) (models.IdempotencyKeys, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.DateCreated = time.Now()
+	dto.DateModified = dto.DateCreated
+	err := tx.Create(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (idempotencyKeysDao IdempotencyKeysDao) Update(dto models.IdempotencyKeys, tx *gorm.DB) (models.IdempotencyKeys, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.DateModified = time.Now()
+	err := tx.Save(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (idempotencyKeysDao IdempotencyKeysDao) Delete(dto models.IdempotencyKeys, tx *gorm.DB) (models.IdempotencyKeys, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	err := tx.Delete(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (idempotencyKeysDao IdempotencyKeysDao) DeleteBefore(date time.Time, tx *gorm.DB) error {
+	if tx == nil {
+		tx = models.Database()
+	}
+	err := tx.Where("date_created < ?", date).Delete(models.IdempotencyKeys{}).Error
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package dao
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/jinzhu/gorm"
+)
+
+// LocksDao takes MySQL named locks, a lock belongs to the connection of tx until it is released
+type LocksDao struct {
+}
+
+// Acquire waits up to timeout seconds for the lock name
+func (locksDao LocksDao) Acquire(tx *gorm.DB, name string, timeout int) (bool, error) {
+	var acquired sql.NullInt64
+	err := tx.Raw("SELECT GET_LOCK(?, ?)", name, timeout).Row().Scan(&acquired)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return acquired.Valid && acquired.Int64 == 1, nil
+}
+
+func (locksDao LocksDao) Release(tx *gorm.DB, name string) error {
+	var released sql.NullInt64
+	err := tx.Raw("SELECT RELEASE_LOCK(?)", name).Row().Scan(&released)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package dao
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+type LogScansDao struct {
+}
+
+func (logScansDao LogScansDao) GetScan(chainID int, contractAddress string, event string) models.LogScans {
+	dto := models.LogScans{}
+	err := models.Database().Where("chain_id = ? AND contract_address = ? AND event = ?", chainID, strings.ToLower(contractAddress), event).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (logScansDao LogScansDao) SaveScan(dto models.LogScans, tx *gorm.DB) (models.LogScans, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.ContractAddress = strings.ToLower(dto.ContractAddress)
+	dto.DateModified = time.Now()
+	if dto.ID <= 0 {
+		dto.DateCreated = dto.DateModified
+	}
+	err := tx.Save(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
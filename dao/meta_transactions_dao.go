@@ -0,0 +1,53 @@
+package dao
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+type MetaTransactionsDao struct {
+}
+
+func (metaTransactionsDao MetaTransactionsDao) Create(dto models.MetaTransactions, tx *gorm.DB) (models.MetaTransactions, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.FromAddress = strings.ToLower(dto.FromAddress)
+	dto.DateCreated = time.Now()
+	dto.DateModified = dto.DateCreated
+	err := tx.Create(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (metaTransactionsDao MetaTransactionsDao) Update(dto models.MetaTransactions, tx *gorm.DB) (models.MetaTransactions, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.DateModified = time.Now()
+	err := tx.Save(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (metaTransactionsDao MetaTransactionsDao) Delete(dto models.MetaTransactions, tx *gorm.DB) (models.MetaTransactions, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	err := tx.Delete(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+type TransferBatchesDao struct {
+}
+
+func (transferBatchesDao TransferBatchesDao) GetById(id int64) models.TransferBatches {
+	dto := models.TransferBatches{}
+	err := models.Database().Where("id = ?", id).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (transferBatchesDao TransferBatchesDao) GetItems(batchID int64) ([]models.TransferBatchItems, error) {
+	dtos := []models.TransferBatchItems{}
+	err := models.Database().Where("batch_id = ?", batchID).Order("item_index asc").Find(&dtos).Error
+	if err != nil {
+		log.Println(err)
+		return dtos, err
+	}
+	return dtos, nil
+}
+
+func (transferBatchesDao TransferBatchesDao) Create(dto models.TransferBatches, tx *gorm.DB) (models.TransferBatches, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.DateCreated = time.Now()
+	dto.DateModified = dto.DateCreated
+	err := tx.Create(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (transferBatchesDao TransferBatchesDao) Update(dto models.TransferBatches, tx *gorm.DB) (models.TransferBatches, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.DateModified = time.Now()
+	err := tx.Save(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (transferBatchesDao TransferBatchesDao) CreateItem(dto models.TransferBatchItems, tx *gorm.DB) (models.TransferBatchItems, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.DateCreated = time.Now()
+	dto.DateModified = dto.DateCreated
+	err := tx.Create(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
+
+func (transferBatchesDao TransferBatchesDao) UpdateItem(dto models.TransferBatchItems, tx *gorm.DB) (models.TransferBatchItems, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.DateModified = time.Now()
+	err := tx.Save(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
@@ -0,0 +1,19 @@
+package dao
+
+import (
+	"log"
+
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+type UserWalletsDao struct {
+}
+
+func (userWalletsDao UserWalletsDao) GetByAddress(userID int64, address string) models.UserWallets {
+	dto := models.UserWallets{}
+	err := models.Database().Where("user_id = ? AND LOWER(address) = LOWER(?)", userID, address).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+type WatchedAddressesDao struct {
+}
+
+func (watchedAddressesDao WatchedAddressesDao) GetListByNetwork(network string) ([]models.WatchedAddresses, error) {
+	dtos := []models.WatchedAddresses{}
+	err := models.Database().Where("network = ?", network).Find(&dtos).Error
+	if err != nil {
+		log.Println(err)
+		return dtos, err
+	}
+	return dtos, nil
+}
+
+func (watchedAddressesDao WatchedAddressesDao) GetByAddress(network string, address string) models.WatchedAddresses {
+	dto := models.WatchedAddresses{}
+	err := models.Database().Where("network = ? AND address = ?", network, strings.ToLower(address)).First(&dto).Error
+	if err != nil {
+		log.Print(err)
+	}
+	return dto
+}
+
+func (watchedAddressesDao WatchedAddressesDao) Create(dto models.WatchedAddresses, tx *gorm.DB) (models.WatchedAddresses, error) {
+	if tx == nil {
+		tx = models.Database()
+	}
+	dto.Address = strings.ToLower(dto.Address)
+	dto.DateCreated = time.Now()
+	dto.DateModified = dto.DateCreated
+	err := tx.Create(&dto).Error
+	if err != nil {
+		log.Println(err)
+		return dto, err
+	}
+	return dto, nil
+}
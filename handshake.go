@@ -0,0 +1,794 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+	"github.com/ninjadotorg/handshake-ethereum/auth"
+	"github.com/ninjadotorg/handshake-ethereum/controller"
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+	"github.com/ninjadotorg/handshake-ethereum/txservice"
+)
+
+type payableRequest struct {
+	Hid      json.Number `json:"hid"`
+	Offchain string      `json:"offchain"`
+	Payer    string      `json:"payer"`
+	Payee    string      `json:"payee"`
+	Value    string      `json:"value"`
+	ValueWei string      `json:"value_wei"`
+	Deadline json.Number `json:"deadline"`
+}
+
+// payableHandler builds the endpoint of a payable contract method, the args follow abi/payable.abi
+func payableHandler(method string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("UserID")
+		if !ok || userID.(int64) <= 0 {
+			respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+			return
+		}
+
+		networkIDStr := c.Query("network_id")
+		if networkIDStr == "" {
+			networkIDStr = "rinkeby"
+		}
+		dryRun := c.Query("dry_run") == "true"
+
+		req := payableRequest{}
+		err := c.Bind(&req)
+		if err != nil {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+			return
+		}
+
+		offchain, err := controller.StringToBytes32(req.Offchain)
+		if err != nil {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "offchain is invalid"))
+			return
+		}
+
+		var args []interface{}
+		var hid *big.Int
+		value := big.NewInt(0)
+		switch method {
+		case "init", "initByPayer":
+			counterparty := req.Payer
+			counterpartyName := "payer"
+			if method == "initByPayer" {
+				counterparty = req.Payee
+				counterpartyName = "payee"
+			}
+			if !common.IsHexAddress(counterparty) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, counterpartyName+" is invalid"))
+				return
+			}
+			amount, err := controller.ParseAmountParam(req.Value, req.ValueWei, 18)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+				return
+			}
+			deadline, err := controller.ParseUint256(req.Deadline.String())
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "deadline is invalid"))
+				return
+			}
+			args = []interface{}{common.HexToAddress(counterparty), amount, deadline, offchain}
+			if method == "initByPayer" {
+				value = amount
+			}
+		default:
+			hid, err = controller.ParseUint256(req.Hid.String())
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "hid is invalid"))
+				return
+			}
+			args = []interface{}{hid, offchain}
+			if method == "shake" {
+				value, err = controller.ParseAmountParam(req.Value, req.ValueWei, 18)
+				if err != nil {
+					respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+					return
+				}
+			}
+		}
+
+		ethTrans, tx, err := sendHandshakeTransaction(c, networkIDStr, param.CONTRACT_PAYABLE, method, hid, args, value, userID.(int64), dryRun)
+		if err != nil {
+			respondSendError(c, err, ethTrans.Hash)
+			return
+		}
+		if dryRun {
+			c.JSON(http.StatusOK, dryRunResult(common.HexToAddress(ethTrans.FromAddress), tx, tx.Gas()))
+			return
+		}
+		result := map[string]interface{}{
+			"status": 1,
+			"data": map[string]interface{}{
+				"contract":         ethTrans.Contract,
+				"contract_address": ethTrans.ToAddress,
+				"method":           method,
+				"from_address":     ethTrans.FromAddress,
+				"hash":             ethTrans.Hash,
+				"value":            controller.FormatAmount(value, 18),
+				"value_wei":        value.String(),
+			},
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+type crowdsaleRequest struct {
+	Hid      json.Number `json:"hid"`
+	Offchain string      `json:"offchain"`
+	Goal     string      `json:"goal"`
+	GoalWei  string      `json:"goal_wei"`
+	Saletime json.Number `json:"saletime"`
+	Deadline json.Number `json:"deadline"`
+	Value    string      `json:"value"`
+	ValueWei string      `json:"value_wei"`
+}
+
+// crowdsaleHandler builds the endpoint of a crowdsale contract method, the args are checked against abi/crowdsale.abi
+func crowdsaleHandler(method string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("UserID")
+		if !ok || userID.(int64) <= 0 {
+			respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+			return
+		}
+
+		networkIDStr := c.Query("network_id")
+		if networkIDStr == "" {
+			networkIDStr = "rinkeby"
+		}
+		dryRun := c.Query("dry_run") == "true"
+
+		req := crowdsaleRequest{}
+		err := c.Bind(&req)
+		if err != nil {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+			return
+		}
+
+		params := map[string]interface{}{
+			"offchain": req.Offchain,
+		}
+		var hid *big.Int
+		if method == "initCrowdsale" {
+			goal, err := controller.ParseAmountParam(req.Goal, req.GoalWei, 18)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "goal is invalid: "+err.Error()))
+				return
+			}
+			params["goal"] = goal.String()
+			params["saletime"] = req.Saletime
+			params["deadline"] = req.Deadline
+		} else {
+			hid, err = controller.ParseUint256(req.Hid.String())
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "hid is invalid"))
+				return
+			}
+			params["hid"] = req.Hid
+		}
+		args, err := controller.ConvertArgs(param.CONTRACT_CROWDSALE, method, params)
+		if err != nil {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+			return
+		}
+
+		value := big.NewInt(0)
+		if controller.IsPayable(param.CONTRACT_CROWDSALE, method) {
+			value, err = controller.ParseAmountParam(req.Value, req.ValueWei, 18)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+				return
+			}
+		}
+
+		ethTrans, tx, err := sendHandshakeTransaction(c, networkIDStr, param.CONTRACT_CROWDSALE, method, hid, args, value, userID.(int64), dryRun)
+		if err != nil {
+			respondSendError(c, err, ethTrans.Hash)
+			return
+		}
+		if dryRun {
+			c.JSON(http.StatusOK, dryRunResult(common.HexToAddress(ethTrans.FromAddress), tx, tx.Gas()))
+			return
+		}
+		result := map[string]interface{}{
+			"status": 1,
+			"data": map[string]interface{}{
+				"contract":         ethTrans.Contract,
+				"contract_address": ethTrans.ToAddress,
+				"method":           method,
+				"from_address":     ethTrans.FromAddress,
+				"hash":             ethTrans.Hash,
+				"value":            controller.FormatAmount(value, 18),
+				"value_wei":        value.String(),
+			},
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+type contractSendRequest struct {
+	Args     map[string]interface{} `json:"args"`
+	Value    string                 `json:"value"`
+	ValueWei string                 `json:"value_wei"`
+	RefID    int64                  `json:"ref_id"`
+}
+
+// contractSendHandler invokes any method of a contract registered in param.ABI_FILES
+func contractSendHandler(c *gin.Context) {
+	userID, ok := c.Get("UserID")
+	if !ok || userID.(int64) <= 0 {
+		respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+		return
+	}
+
+	networkIDStr := c.Query("network_id")
+	if networkIDStr == "" {
+		networkIDStr = "rinkeby"
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	contract := c.Param("contract")
+	if _, ok := param.ABI_FILES[contract]; !ok {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "contract is invalid"))
+		return
+	}
+	if !common.IsHexAddress(c.Param("address")) {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "address is invalid"))
+		return
+	}
+	contractAddress := common.HexToAddress(c.Param("address"))
+
+	contractAbi, err := controller.LoadAbi(contract)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	method := c.Param("method")
+	abiMethod, ok := contractAbi.Methods[method]
+	if !ok || abiMethod.Const {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "method is invalid"))
+		return
+	}
+
+	// numbers are kept as json.Number so uint256 args are not rounded
+	req := contractSendRequest{}
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	err = decoder.Decode(&req)
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+		return
+	}
+	args, err := controller.ConvertArgs(contract, method, req.Args)
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+		return
+	}
+
+	value := big.NewInt(0)
+	if req.Value != "" || req.ValueWei != "" {
+		if !controller.IsPayable(contract, method) {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, method+" is not payable"))
+			return
+		}
+		value, err = controller.ParseAmountParam(req.Value, req.ValueWei, 18)
+		if err != nil {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+			return
+		}
+	}
+
+	ethTrans, tx, err := sendContractTransaction(networkIDStr, contract, contractAddress, method, args, value, userID.(int64), req.RefID, dryRun)
+	if err != nil {
+		respondSendError(c, err, ethTrans.Hash)
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, dryRunResult(common.HexToAddress(ethTrans.FromAddress), tx, tx.Gas()))
+		return
+	}
+	result := map[string]interface{}{
+		"status": 1,
+		"data": map[string]interface{}{
+			"contract":         ethTrans.Contract,
+			"contract_address": ethTrans.ToAddress,
+			"method":           method,
+			"from_address":     ethTrans.FromAddress,
+			"hash":             ethTrans.Hash,
+			"data":             ethTrans.Data,
+			"value":            controller.FormatAmount(value, 18),
+			"value_wei":        value.String(),
+		},
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// sendHandshakeTransaction sends a call of a handshake contract for a user. The ether attached by the key of the
+// network is bounded by param.HandshakeLimits and the methods taking a hid, other than shake, are restricted to the
+// parties of the handshake. Admins skip both checks.
+func sendHandshakeTransaction(c *gin.Context, networkIDStr string, contract string, method string, hid *big.Int, args []interface{}, value *big.Int, userID int64, dryRun bool) (models.EthereumTransactions, *types.Transaction, error) {
+	network, ok := param.Conf.Networks[networkIDStr]
+	if !ok {
+		return models.EthereumTransactions{}, nil, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid")
+	}
+	contractAddressStr, ok := network.Contracts[contract]
+	if !ok || !common.IsHexAddress(contractAddressStr) {
+		return models.EthereumTransactions{}, nil, controller.NewAPIError(controller.ErrCodeInvalidParam, contract+" contract is not configured on "+networkIDStr)
+	}
+	refID := int64(0)
+	if hid != nil && hid.IsInt64() {
+		refID = hid.Int64()
+	}
+
+	identity, _ := c.Get("Identity")
+	if identity.(auth.Identity).IsAdmin(param.Conf.Authorization) {
+		return sendContractTransaction(networkIDStr, contract, common.HexToAddress(contractAddressStr), method, args, value, userID, refID, dryRun)
+	}
+	if hid != nil && method != "shake" {
+		chainID, err := controller.NetworkChainID(etherClients[networkIDStr], network)
+		if err != nil {
+			return models.EthereumTransactions{}, nil, err
+		}
+		err = controller.CheckHandshakeParty(networkIDStr, int(chainID.Int64()), contractAddressStr, hid, userID)
+		if err != nil {
+			return models.EthereumTransactions{}, nil, err
+		}
+	}
+	if dryRun {
+		err := controller.CheckHandshakeValue(network.Handshake, networkIDStr, userID, value)
+		if err != nil {
+			return models.EthereumTransactions{}, nil, err
+		}
+		return sendContractTransaction(networkIDStr, contract, common.HexToAddress(contractAddressStr), method, args, value, userID, refID, dryRun)
+	}
+	reservation, err := controller.ReserveHandshakeValue(network.Handshake, networkIDStr, contract, method, userID, value)
+	if err != nil {
+		return models.EthereumTransactions{}, nil, err
+	}
+	ethTrans, tx, err := sendContractTransaction(networkIDStr, contract, common.HexToAddress(contractAddressStr), method, args, value, userID, refID, dryRun)
+	// the reservation still counts the value when the call failed after it was broadcast
+	if err == nil || ethTrans.Hash == "" {
+		controller.ReleaseHandshakeValue(reservation)
+	}
+	return ethTrans, tx, err
+}
+
+// sendContractTransaction signs a contract call with the key of the network, broadcasts it and records it in ethereum_transactions.
+// On a dry run the call is only simulated and the unsigned transaction is returned.
+func sendContractTransaction(networkIDStr string, contract string, contractAddress common.Address, method string, args []interface{}, value *big.Int, userID int64, refID int64, dryRun bool) (models.EthereumTransactions, *types.Transaction, error) {
+	network, ok := param.Conf.Networks[networkIDStr]
+	if !ok {
+		return models.EthereumTransactions{}, nil, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid")
+	}
+	txService, ok := txServices[networkIDStr]
+	if !ok {
+		return models.EthereumTransactions{}, nil, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid")
+	}
+
+	data, err := controller.PackContractCall(contract, method, args...)
+	if err != nil {
+		return models.EthereumTransactions{}, nil, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error())
+	}
+
+	privateKey, err := crypto.HexToECDSA(network.PrivateKey)
+	if err != nil {
+		return models.EthereumTransactions{}, nil, err
+	}
+
+	sent, err := txService.Send(txservice.Request{
+		PrivateKey: privateKey,
+		To:         contractAddress,
+		Value:      value,
+		Data:       data,
+		DryRun:     dryRun,
+		Record: models.EthereumTransactions{
+			Contract: contract,
+			RefType:  contract + "_" + method,
+			RefID:    refID,
+			UserID:   userID,
+			Value:    controller.AmountToFloat(value, 18),
+		},
+	})
+	return sent.Record, sent.Transaction, err
+}
+
+// dryRunResult describes the transaction a sending endpoint would have broadcast
+func dryRunResult(fromAddress common.Address, tx *types.Transaction, estimatedGas uint64) map[string]interface{} {
+	fee := new(big.Int).Mul(tx.GasPrice(), new(big.Int).SetUint64(tx.Gas()))
+	return map[string]interface{}{
+		"status": 1,
+		"data": map[string]interface{}{
+			"dry_run":       true,
+			"from_address":  fromAddress.Hex(),
+			"to_address":    tx.To().Hex(),
+			"nonce":         tx.Nonce(),
+			"gas":           tx.Gas(),
+			"estimated_gas": estimatedGas,
+			"gas_price":     tx.GasPrice().String(),
+			"fee":           controller.FormatAmount(fee, 18),
+			"fee_wei":       fee.String(),
+			"value":         controller.FormatAmount(tx.Value(), 18),
+			"value_wei":     tx.Value().String(),
+			"data":          hexutil.Encode(tx.Data()),
+		},
+	}
+}
+
+type metaTxRequest struct {
+	From      string                 `json:"from"`
+	Contract  string                 `json:"contract"`
+	Method    string                 `json:"method"`
+	Args      map[string]interface{} `json:"args"`
+	Gas       json.Number            `json:"gas"`
+	Nonce     json.Number            `json:"nonce"`
+	Signature string                 `json:"signature"`
+	RefID     int64                  `json:"ref_id"`
+}
+
+// metaTxHandler relays a handshake intent signed by the user with EIP-712 through the forwarder of the network,
+// a dry run without signature returns the typed data to sign
+func metaTxHandler(c *gin.Context) {
+	userID, ok := c.Get("UserID")
+	if !ok || userID.(int64) <= 0 {
+		respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+		return
+	}
+
+	networkIDStr := c.Query("network_id")
+	if networkIDStr == "" {
+		networkIDStr = "rinkeby"
+	}
+	dryRun := c.Query("dry_run") == "true"
+	network, ok := param.Conf.Networks[networkIDStr]
+	if !ok {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+		return
+	}
+	etherClient, ok := etherClients[networkIDStr]
+	if !ok {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+		return
+	}
+	txService, ok := txServices[networkIDStr]
+	if !ok {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+		return
+	}
+	conf := network.MetaTx
+	if conf.DailyGasQuota == 0 {
+		respondError(c, controller.NewAPIError(controller.ErrCodeForbidden, "meta transactions are not enabled on "+networkIDStr))
+		return
+	}
+	relayerKey, err := controller.MetaTxRelayerKey(networkIDStr, network)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// numbers are kept as json.Number so uint256 args are not rounded
+	req := metaTxRequest{}
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	err = decoder.Decode(&req)
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+		return
+	}
+
+	allowed := false
+	for _, contract := range controller.MetaTxContracts(conf) {
+		allowed = allowed || contract == req.Contract
+	}
+	contractAddressStr := network.Contracts[req.Contract]
+	if !allowed || !common.IsHexAddress(contractAddressStr) {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "contract is invalid"))
+		return
+	}
+	contractAbi, err := controller.LoadAbi(req.Contract)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	abiMethod, ok := contractAbi.Methods[req.Method]
+	if !ok || abiMethod.Const {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "method is invalid"))
+		return
+	}
+	if !common.IsHexAddress(req.From) {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "from is invalid"))
+		return
+	}
+	if network.RequireRegisteredSender && !controller.IsUserWallet(userID.(int64), req.From) {
+		respondError(c, controller.NewAPIError(controller.ErrCodeForbidden, "from is not a wallet of the user"))
+		return
+	}
+	gas, err := strconv.ParseUint(req.Gas.String(), 10, 64)
+	if err != nil || gas == 0 {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "gas is invalid"))
+		return
+	}
+	args, err := controller.ConvertArgs(req.Contract, req.Method, req.Args)
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+		return
+	}
+	data, err := controller.PackContractCall(req.Contract, req.Method, args...)
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+		return
+	}
+
+	chainID, err := controller.NetworkChainID(etherClient, network)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	nonce, err := controller.MetaTxNonce(etherClient, conf, common.HexToAddress(req.From))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	metaReq := controller.MetaTxRequest{
+		From:  common.HexToAddress(req.From),
+		To:    common.HexToAddress(contractAddressStr),
+		Value: big.NewInt(0),
+		Gas:   gas,
+		Nonce: nonce,
+		Data:  data,
+	}
+	verifyingContract := common.HexToAddress(conf.Forwarder)
+	hash := controller.MetaTxHash(conf, chainID, verifyingContract, metaReq)
+
+	if dryRun && req.Signature == "" {
+		name, version := controller.MetaTxDomain(conf)
+		result := map[string]interface{}{
+			"status": 1,
+			"data": map[string]interface{}{
+				"dry_run": true,
+				"domain": map[string]interface{}{
+					"name":              name,
+					"version":           version,
+					"chainId":           chainID.String(),
+					"verifyingContract": verifyingContract.Hex(),
+				},
+				"message": map[string]interface{}{
+					"from":  metaReq.From.Hex(),
+					"to":    metaReq.To.Hex(),
+					"value": "0",
+					"gas":   strconv.FormatUint(gas, 10),
+					"nonce": strconv.FormatUint(nonce, 10),
+					"data":  hexutil.Encode(data),
+				},
+				"hash": hexutil.Encode(hash),
+			},
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	if req.Nonce.String() != strconv.FormatUint(nonce, 10) {
+		respondError(c, controller.NewAPIError(controller.ErrCodeNonceConflict, "nonce must be "+strconv.FormatUint(nonce, 10)))
+		return
+	}
+	signature, err := hexutil.Decode(req.Signature)
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "signature is invalid"))
+		return
+	}
+	signer, err := controller.RecoverMetaTxSigner(hash, signature)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if signer != metaReq.From {
+		respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "signature is not from "+metaReq.From.Hex()))
+		return
+	}
+
+	// the forwarder needs gas on top of the call it forwards, the quota is charged on the estimated gas
+	txReq := txservice.Request{
+		PrivateKey: relayerKey,
+		To:         verifyingContract,
+		Data:       controller.PackForwarderExecute(metaReq, signature),
+		DryRun:     true,
+		Record: models.EthereumTransactions{
+			Contract: req.Contract,
+			RefType:  controller.MetaTxRefType,
+			RefID:    req.RefID,
+			UserID:   userID.(int64),
+		},
+	}
+	priced, err := txService.Send(txReq)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if dryRun {
+		err = controller.CheckMetaTxQuota(conf, networkIDStr, userID.(int64), priced.Transaction.Gas())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, dryRunResult(priced.From, priced.Transaction, priced.EstimatedGas))
+		return
+	}
+	txReq.GasLimit = priced.Transaction.Gas()
+	txReq.DryRun = false
+
+	// the reservation holds the gas in the quota until the transaction is recorded
+	reservation, err := controller.ReserveMetaTxQuota(conf, networkIDStr, userID.(int64), priced.Transaction.Gas())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	metaTrans, err := controller.ReserveMetaTransaction(models.MetaTransactions{
+		UserID:      userID.(int64),
+		Network:     networkIDStr,
+		FromAddress: metaReq.From.Hex(),
+		Nonce:       int64(nonce),
+		Contract:    req.Contract,
+		Method:      req.Method,
+	})
+	if err != nil {
+		controller.ReleaseMetaTxQuota(reservation)
+		respondError(c, err)
+		return
+	}
+	// the hash is set once the transaction is broadcast, even when recording it fails
+	sent, sendErr := txService.Send(txReq)
+	err = controller.FinishMetaTransaction(metaTrans, sent.Record.Hash)
+	if err != nil {
+		log.Println("metaTxHandler", err)
+	}
+	// a broadcast transaction which was not recorded keeps its reservation
+	if sendErr == nil || sent.Record.Hash == "" {
+		controller.ReleaseMetaTxQuota(reservation)
+	}
+	if sendErr != nil {
+		respondSendError(c, sendErr, sent.Record.Hash)
+		return
+	}
+
+	result := map[string]interface{}{
+		"status": 1,
+		"data": map[string]interface{}{
+			"contract":         req.Contract,
+			"contract_address": metaReq.To.Hex(),
+			"method":           req.Method,
+			"from_address":     metaReq.From.Hex(),
+			"relayer_address":  sent.From.Hex(),
+			"nonce":            nonce,
+			"hash":             sent.Record.Hash,
+			"data":             hexutil.Encode(data),
+		},
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// getHandshakesHandler lists the handshakes of the user projected from the contract logs
+func getHandshakesHandler(c *gin.Context) {
+	userID, ok := c.Get("UserID")
+	if !ok || userID.(int64) <= 0 {
+		respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+		return
+	}
+	filter := dao.HandshakesFilter{
+		UserID:   userID.(int64),
+		State:    c.Query("state"),
+		Offchain: c.Query("offchain"),
+		Limit:    20,
+	}
+	var err error
+	if c.Query("chain_id") != "" {
+		filter.ChainID, err = strconv.Atoi(c.Query("chain_id"))
+		if err != nil {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "chain_id is invalid"))
+			return
+		}
+	}
+	contract := c.Query("contract")
+	if common.IsHexAddress(contract) {
+		filter.ContractAddress = contract
+	} else {
+		filter.Contract = contract
+	}
+	for name, value := range map[string]*string{"payer": &filter.Payer, "payee": &filter.Payee, "address": &filter.Address} {
+		address := c.Query(name)
+		if address == "" {
+			continue
+		}
+		if !common.IsHexAddress(address) {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, name+" is invalid"))
+			return
+		}
+		*value = address
+	}
+	if c.Query("cursor") != "" {
+		filter.Cursor, err = strconv.ParseInt(c.Query("cursor"), 10, 64)
+		if err != nil {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "cursor is invalid"))
+			return
+		}
+	}
+	if c.Query("limit") != "" {
+		filter.Limit, err = strconv.Atoi(c.Query("limit"))
+		if err != nil || filter.Limit <= 0 || filter.Limit > 100 {
+			respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "limit is invalid"))
+			return
+		}
+	}
+
+	handshakes, err := controller.GetHandshakes(filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	nextCursor := int64(0)
+	if len(handshakes) == filter.Limit {
+		nextCursor = handshakes[len(handshakes)-1].ID
+	}
+
+	result := map[string]interface{}{
+		"status": 1,
+		"data": map[string]interface{}{
+			"items":       handshakes,
+			"next_cursor": nextCursor,
+		},
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// getHandshakeHandler returns a handshake with its events in the order they were emitted,
+// the contract is an address or the name of a contract indexed on the chain
+func getHandshakeHandler(c *gin.Context) {
+	userID, ok := c.Get("UserID")
+	if !ok || userID.(int64) <= 0 {
+		respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+		return
+	}
+	chainID, err := strconv.Atoi(c.Param("chain"))
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "chain is invalid"))
+		return
+	}
+	hid, err := controller.ParseUint256(c.Param("hid"))
+	if err != nil {
+		respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "hid is invalid"))
+		return
+	}
+	contractAddress, err := controller.ResolveHandshakeContract(chainID, c.Param("contract"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	handshake, history, err := controller.GetHandshake(chainID, contractAddress, hid, userID.(int64))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	result := map[string]interface{}{
+		"status": 1,
+		"data": map[string]interface{}{
+			"handshake": handshake,
+			"history":   history,
+		},
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,150 @@
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const hardenedOffset = 0x80000000
+
+var errInvalidKey = errors.New("derived key is invalid")
+
+// Key is an extended private key of BIP-32
+type Key struct {
+	PrivateKey *ecdsa.PrivateKey
+	ChainCode  []byte
+}
+
+// NewMasterKey returns the master key of seed
+func NewMasterKey(seed []byte) (*Key, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	privateKey, err := crypto.ToECDSA(sum[:32])
+	if err != nil {
+		return nil, errInvalidKey
+	}
+	return &Key{PrivateKey: privateKey, ChainCode: sum[32:]}, nil
+}
+
+// Child derives the child key at index, indexes from 2^31 are hardened
+func (key *Key) Child(index uint32) (*Key, error) {
+	data := []byte{}
+	if index >= hardenedOffset {
+		data = append(data, 0)
+		data = append(data, math.PaddedBigBytes(key.PrivateKey.D, 32)...)
+	} else {
+		data = append(data, crypto.CompressPubkey(&key.PrivateKey.PublicKey)...)
+	}
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+	data = append(data, indexBytes...)
+
+	mac := hmac.New(sha512.New, key.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, errInvalidKey
+	}
+	d := tweak.Add(tweak, key.PrivateKey.D)
+	d.Mod(d, n)
+	if d.Sign() == 0 {
+		return nil, errInvalidKey
+	}
+	privateKey, err := crypto.ToECDSA(math.PaddedBigBytes(d, 32))
+	if err != nil {
+		return nil, errInvalidKey
+	}
+	return &Key{PrivateKey: privateKey, ChainCode: sum[32:]}, nil
+}
+
+// Derive derives the key at path from key
+func (key *Key) Derive(path accounts.DerivationPath) (*Key, error) {
+	var err error
+	for _, index := range path {
+		key, err = key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Wallet derives the keys of the deposit addresses, the keys of the base paths are cached
+type Wallet struct {
+	master *Key
+	mutex  sync.Mutex
+	bases  map[string]*Key
+}
+
+func New(seed []byte) (*Wallet, error) {
+	master, err := NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	return &Wallet{master: master, bases: map[string]*Key{}}, nil
+}
+
+// NewFromKeystore decrypts a keystore file, its private key is the seed of the wallet
+func NewFromKeystore(file string, passphrase string) (*Wallet, error) {
+	keyJSON, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return New(math.PaddedBigBytes(key.PrivateKey.D, 32))
+}
+
+// UserPath returns the path of the address of userID under base
+func UserPath(base accounts.DerivationPath, userID int64) (accounts.DerivationPath, error) {
+	if userID <= 0 || userID >= hardenedOffset {
+		return nil, errors.New("user id can not be used as a derivation index")
+	}
+	path := make(accounts.DerivationPath, len(base), len(base)+1)
+	copy(path, base)
+	return append(path, uint32(userID)), nil
+}
+
+// Derive returns the private key at path
+func (wallet *Wallet) Derive(path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	if len(path) == 0 {
+		return wallet.master.PrivateKey, nil
+	}
+	base := path[:len(path)-1]
+	baseStr := base.String()
+	wallet.mutex.Lock()
+	baseKey, ok := wallet.bases[baseStr]
+	wallet.mutex.Unlock()
+	if !ok {
+		var err error
+		baseKey, err = wallet.master.Derive(base)
+		if err != nil {
+			return nil, err
+		}
+		wallet.mutex.Lock()
+		wallet.bases[baseStr] = baseKey
+		wallet.mutex.Unlock()
+	}
+	key, err := baseKey.Child(path[len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	return key.PrivateKey, nil
+}
@@ -0,0 +1,121 @@
+package hdwallet
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// the private keys and chain codes of the test vectors of BIP-32
+var bip32Vectors = []struct {
+	seed string
+	path string
+	key  string
+	code string
+}{
+	// test vector 1
+	{"000102030405060708090a0b0c0d0e0f", "m",
+		"e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35",
+		"873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508"},
+	{"000102030405060708090a0b0c0d0e0f", "m/0'",
+		"edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea",
+		"47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141"},
+	{"000102030405060708090a0b0c0d0e0f", "m/0'/1",
+		"3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368",
+		"2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19"},
+	{"000102030405060708090a0b0c0d0e0f", "m/0'/1/2'",
+		"cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca",
+		"04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f"},
+	{"000102030405060708090a0b0c0d0e0f", "m/0'/1/2'/2",
+		"0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4",
+		"cfb71883f01676f587d023cc53a35bc7f88f724b1f8c2892ac1275ac822a3edd"},
+	{"000102030405060708090a0b0c0d0e0f", "m/0'/1/2'/2/1000000000",
+		"471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8",
+		"c783e67b921d2beb8f6b389cc646d7263b4145701dadd2161548a8b078e65e9e"},
+	// test vector 3, the leading zeros of the private keys are kept
+	{"4b381541583be4423346c643850da4b320e46a87ae3d2a4e6da11eba819cd4acba45d239319ac14f863b8d5ab5a0d0c64d2e8a1e7d1457df2e5a3c51c73235be", "m",
+		"00ddb80b067e0d4993197fe10f2657a844a384589847602d56f0c629c81aae32",
+		"01d28a3e53cffa419ec122c968b3259e16b65076495494d97cae10bbfec3c36f"},
+	{"4b381541583be4423346c643850da4b320e46a87ae3d2a4e6da11eba819cd4acba45d239319ac14f863b8d5ab5a0d0c64d2e8a1e7d1457df2e5a3c51c73235be", "m/0'",
+		"491f7a2eebc7b57028e0d3faa0acda02e75c33b03c48fb288c41e2ea44e1daef",
+		"e5fea12a97b927fc9dc3d2cb0d1ea1cf50aa5a1fdc1f933e8906bb38df3377bd"},
+}
+
+func TestDerive(t *testing.T) {
+	for _, vector := range bip32Vectors {
+		seed, err := hex.DecodeString(vector.seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		master, err := NewMasterKey(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := accounts.DerivationPath{}
+		if vector.path != "m" {
+			path, err = accounts.ParseDerivationPath(vector.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		key, err := master.Derive(path)
+		if err != nil {
+			t.Errorf("%s: %v", vector.path, err)
+			continue
+		}
+		if got := hex.EncodeToString(math.PaddedBigBytes(key.PrivateKey.D, 32)); got != vector.key {
+			t.Errorf("%s: key %s, want %s", vector.path, got, vector.key)
+		}
+		if got := hex.EncodeToString(key.ChainCode); got != vector.code {
+			t.Errorf("%s: chain code %s, want %s", vector.path, got, vector.code)
+		}
+	}
+}
+
+func TestWalletDerive(t *testing.T) {
+	seed, _ := hex.DecodeString(bip32Vectors[0].seed)
+	wallet, err := New(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := accounts.ParseDerivationPath("m/0'/1/2'/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := UserPath(base, 1000000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second derivation uses the cached base key
+	for i := 0; i < 2; i++ {
+		privateKey, err := wallet.Derive(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(crypto.FromECDSA(privateKey)); got != bip32Vectors[5].key {
+			t.Errorf("key %s, want %s", got, bip32Vectors[5].key)
+		}
+	}
+}
+
+func TestUserPath(t *testing.T) {
+	base := accounts.DerivationPath{0x80000000 + 44, 0x80000000 + 60, 0x80000000, 0}
+	path, err := UserPath(base, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.String() != "m/44'/60'/0'/0/7" {
+		t.Errorf("path %s, want m/44'/60'/0'/0/7", path)
+	}
+	if len(base) != 4 {
+		t.Error("base path is modified")
+	}
+	for _, userID := range []int64{0, -1, hardenedOffset} {
+		if _, err := UserPath(base, userID); err == nil {
+			t.Errorf("user id %d is accepted", userID)
+		}
+	}
+}
@@ -1,34 +1,55 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"math/big"
 	"net/http"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/crypto/sha3"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/gin-gonic/gin"
+	"github.com/ninjadotorg/handshake-ethereum/auth"
 	"github.com/ninjadotorg/handshake-ethereum/controller"
+	"github.com/ninjadotorg/handshake-ethereum/dao"
+	"github.com/ninjadotorg/handshake-ethereum/hdwallet"
 	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/monitor"
 	"github.com/ninjadotorg/handshake-ethereum/param"
+	"github.com/ninjadotorg/handshake-ethereum/txservice"
 	"github.com/robfig/cron"
 	"github.com/urfave/cli"
 )
 
 var (
-	app           *cli.App
-	etherClients  = map[string]*ethclient.Client{}
-	freeTokenNone = uint64(0)
-	freeEtherNone = uint64(0)
+	app          *cli.App
+	etherClients = map[string]*ethclient.Client{}
+	balanceCache *controller.Cache
+	txServices   = map[string]*txservice.Service{}
+	// hdWallet derives the deposit addresses, it is nil when no keystore is configured
+	hdWallet *hdwallet.Wallet
+	// gas limit of the ether and token transfers
+	transferGasLimit = uint64(100000)
+	// faucets pay 5 gwei above the suggested gas price
+	faucetGasPriceBump = big.NewInt(5 * 1e9)
+	// requestIDRegexp limits the X-Request-Id headers kept from the callers
+	requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
 )
 
 func init() {
@@ -64,30 +85,83 @@ func main() {
 				return serviceApp()
 			},
 		},
+		{
+			Name:  "backfill-handshakes",
+			Usage: "decode the stored handshake logs again and rebuild the handshakes",
+			Action: func(c *cli.Context) error {
+				return backfillHandshakesApp()
+			},
+		},
 	}
 	// Run the CLI app
 	if err := app.Run(os.Args); err != nil {
 		log.Println("error", err)
+		os.Exit(1)
 	}
-	select {}
+}
+
+func backfillHandshakesApp() error {
+	err := param.Initialize(os.Getenv("APP_CONF"))
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	logsController, err := controller.NewConcotrller(param.Conf.Agrs)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	return logsController.BackfillHandshakes()
 }
 
 func workerApp() error {
 
 	param.Initialize(os.Getenv("APP_CONF"))
-	controller, err := controller.NewConcotrller(param.Conf.Agrs)
+	logsController, err := controller.NewConcotrller(param.Conf.Agrs)
 	if err != nil {
 		log.Print(err)
 		return err
 	}
+	alertSink, err := monitor.NewSink(param.Conf.Alerts)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	balanceMonitors := []*monitor.Monitor{}
+	for k, network := range param.Conf.Networks {
+		etherClient, err := ethclient.Dial(network.NetworkURL)
+		if err != nil {
+			log.Print(err)
+			return err
+		}
+		balanceMonitors = append(balanceMonitors, monitor.New(k, network, etherClient, alertSink, time.Duration(param.Conf.Alerts.Interval)*time.Second))
+	}
 	var appCron = cron.New()
 	appCron.AddFunc("*/16 * * * * *", func() {
 		log.Println("job for scan ethereum logs every 16s")
-		controller.Process()
+		logsController.Process()
+	})
+	appCron.AddFunc("*/16 * * * * *", func() {
+		log.Println("job for scan deposits every 16s")
+		logsController.ScanDeposits()
+	})
+	appCron.AddFunc("0 * * * * *", func() {
+		log.Println("job for check operator balances every minute")
+		for _, balanceMonitor := range balanceMonitors {
+			go balanceMonitor.Check()
+		}
+	})
+	appCron.AddFunc("0 0 * * * *", func() {
+		log.Println("job for clean expired idempotency keys every hour")
+		err := controller.CleanIdempotencyKeys()
+		if err != nil {
+			log.Println(err)
+		}
 	})
 	appCron.Start()
 
-	return nil
+	// the jobs run until the worker is stopped
+	select {}
 }
 
 func serviceApp() error {
@@ -96,12 +170,38 @@ func serviceApp() error {
 		panic(err)
 	}
 
+	if param.Conf.HDWallet.KeystoreFile != "" {
+		passphraseEnv := param.Conf.HDWallet.PassphraseEnv
+		if passphraseEnv == "" {
+			passphraseEnv = "HD_WALLET_PASSPHRASE"
+		}
+		hdWallet, err = hdwallet.NewFromKeystore(param.Conf.HDWallet.KeystoreFile, os.Getenv(passphraseEnv))
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	for k, network := range param.Conf.Networks {
 		etherClient, err := ethclient.Dial(network.NetworkURL)
 		if err != nil {
 			panic(err)
 		}
 		etherClients[k] = etherClient
+		txServices[k] = controller.NewTxService(k, etherClient)
+		if hdWallet != nil {
+			txServices[k].Keys = controller.HDKeySource{Network: k, Wallet: hdWallet}
+		}
+	}
+
+	balanceCacheTTL := param.Conf.BalanceCacheTTL
+	if balanceCacheTTL <= 0 {
+		balanceCacheTTL = 10
+	}
+	balanceCache = controller.NewCache(time.Duration(balanceCacheTTL) * time.Second)
+
+	authenticators, err := auth.NewAuthenticators(param.Conf.Auth)
+	if err != nil {
+		panic(err)
 	}
 
 	// Logger
@@ -114,8 +214,9 @@ func serviceApp() error {
 	log.SetFlags(log.Lshortfile | log.LstdFlags)
 
 	router := gin.Default()
+	router.Use(RequestID())
 	router.Use(Logger())
-	router.Use(AuthorizeMiddleware())
+	router.Use(AuthorizeMiddleware(authenticators))
 	index := router.Group("/")
 	{
 		index.GET("/", func(c *gin.Context) {
@@ -125,600 +226,980 @@ func serviceApp() error {
 			}
 			c.JSON(http.StatusOK, result)
 		})
-		index.POST("/tx", func(c *gin.Context) {
-
+		index.GET("/wallet/address", Authorize("GET /wallet/address", true), func(c *gin.Context) {
 			userID, ok := c.Get("UserID")
+			if !ok || userID.(int64) <= 0 {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+			networkIDStr := c.Query("network_id")
+			if networkIDStr == "" {
+				networkIDStr = "rinkeby"
+			}
+			network, ok := param.Conf.Networks[networkIDStr]
 			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "user is not logged in",
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
 				return
 			}
-			if userID.(int64) <= 0 {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "user is not logged in",
-				}
-				c.JSON(http.StatusOK, result)
+			if hdWallet == nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "deposit addresses are not enabled"))
 				return
 			}
-
-			ethTrans := new(models.EthereumTransactions)
-			err := c.Bind(&ethTrans)
+			basePath, err := controller.HDBasePath(param.Conf.HDWallet, network)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, err)
 				return
 			}
-			ethTrans.UserID = userID.(int64)
-			_, err = controller.CreateEthereumTransaction(*ethTrans)
+
+			wallet, err := controller.GetDepositAddress(hdWallet, networkIDStr, basePath, userID.(int64))
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, err)
 				return
 			}
-
 			result := map[string]interface{}{
-				"status":  1,
-				"message": "OK",
+				"status": 1,
+				"data": map[string]interface{}{
+					"network":          wallet.Network,
+					"address":          common.HexToAddress(wallet.Address).Hex(),
+					"derivation_path":  wallet.DerivationPath,
+					"derivation_index": wallet.DerivationIndex,
+				},
 			}
 			c.JSON(http.StatusOK, result)
 		})
-		index.POST("/transfer", func(c *gin.Context) {
-			userID, ok := c.Get("UserID")
-			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "user is not logged in",
-				}
-				c.JSON(http.StatusOK, result)
-				return
-			}
-			if userID.(int64) <= 0 {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "user is not logged in",
-				}
-				c.JSON(http.StatusOK, result)
-				return
-			}
-
+		index.GET("/balance", Authorize("GET /balance", true), func(c *gin.Context) {
 			networkIDStr := c.Query("network_id")
 			if networkIDStr == "" {
 				networkIDStr = "rinkeby"
 			}
-
-			etherClient, ok := etherClients[networkIDStr]
+			network, ok := param.Conf.Networks[networkIDStr]
 			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "network_id is invalid",
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
 				return
 			}
 
-			privateKeyStr := c.Query("private_key")
-			if privateKeyStr == "" {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "private_key is invalid",
-				}
-				c.JSON(http.StatusOK, result)
-				return
-			}
-			toAddressStr := c.Query("to_address")
-			if toAddressStr == "" {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "to_address is invalid",
-				}
-				c.JSON(http.StatusOK, result)
-				return
-			}
-			valueFloat, err := strconv.ParseFloat(c.Query("value"), 64)
-
-			privateKey, err := crypto.HexToECDSA(privateKeyStr)
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
-				return
-			}
-			publicKey := privateKey.Public()
-			publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
+			etherClient, ok := etherClients[networkIDStr]
 			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "error casting public key to ECDSA",
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
 				return
 			}
 
-			fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-
-			nonce, err := etherClient.PendingNonceAt(context.Background(), fromAddress)
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+			addressStr := c.Query("address")
+			if !common.IsHexAddress(addressStr) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "address is invalid"))
 				return
 			}
+			address := common.HexToAddress(addressStr)
 
-			if err != nil {
+			cacheKey := "balance:" + networkIDStr + ":" + strings.ToLower(address.Hex())
+			if data, ok := balanceCache.Get(cacheKey); ok {
 				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
+					"status": 1,
+					"data":   data,
 				}
 				c.JSON(http.StatusOK, result)
 				return
 			}
 
-			value := big.NewInt(int64(valueFloat * 1e18))
-			gasLimit := uint64(100000) // in units
-			gasPrice, err := etherClient.SuggestGasPrice(context.Background())
+			balance, err := etherClient.BalanceAt(context.Background(), address, nil)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, err)
 				return
 			}
-			toAddress := common.HexToAddress(toAddressStr)
 
-			tx := types.NewTransaction(nonce, toAddress, value, gasLimit, gasPrice, nil)
-			signedTx, err := types.SignTx(tx, types.HomesteadSigner{}, privateKey)
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
+			tokens := []map[string]interface{}{}
+			for _, token := range network.GetTokens() {
+				item := map[string]interface{}{
+					"token":         token.Symbol,
+					"token_address": token.Address,
+					"decimals":      token.Decimals,
 				}
-				c.JSON(http.StatusOK, result)
-				return
-			}
-			err = etherClient.SendTransaction(context.Background(), signedTx)
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
+				tokenBalance, err := controller.GetTokenBalance(etherClient, token, address)
+				if err != nil {
+					log.Println("balance", token.Address, err)
+					item["error"] = err.Error()
+				} else {
+					item["balance"] = controller.FormatAmount(tokenBalance, token.Decimals)
+					item["balance_wei"] = tokenBalance.String()
 				}
-				c.JSON(http.StatusOK, result)
-				return
+				tokens = append(tokens, item)
 			}
-
-			ethTrans := models.EthereumTransactions{}
-			ethTrans.Hash = signedTx.Hash().Hex()
-			ethTrans.FromAddress = fromAddress.Hex()
-			ethTrans.ToAddress = toAddressStr
-			ethTrans.RefType = "user_transfer"
-			ethTrans.RefID = userID.(int64)
-			ethTrans.UserID = userID.(int64)
-			ethTrans.Network = networkIDStr
-
-			_, err = controller.CreateEthereumTransaction(ethTrans)
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
-				return
+			data := map[string]interface{}{
+				"network":   networkIDStr,
+				"address":   address.Hex(),
+				"ether":     controller.FormatAmount(balance, 18),
+				"ether_wei": balance.String(),
+				"tokens":    tokens,
 			}
-			txHash := signedTx.Hash().Hex()
-			log.Printf("hash : %s", txHash)
+			balanceCache.Set(cacheKey, data)
+
 			result := map[string]interface{}{
 				"status": 1,
-				"data": map[string]interface{}{
-					"from_address": fromAddress.Hex(),
-					"to_address":   toAddressStr,
-					"hash":         txHash,
-					"value":        valueFloat,
-				},
+				"data":   data,
 			}
 			c.JSON(http.StatusOK, result)
-			return
 		})
-
-		index.POST("/free-ether", func(c *gin.Context) {
-			userID, ok := c.Get("UserID")
-			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "user is not logged in",
-				}
-				c.JSON(http.StatusOK, result)
-				return
-			}
-			if userID.(int64) <= 0 {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "user is not logged in",
-				}
-				c.JSON(http.StatusOK, result)
-				return
-			}
-
+		index.GET("/allowance", Authorize("GET /allowance", true), func(c *gin.Context) {
 			networkIDStr := c.Query("network_id")
 			if networkIDStr == "" {
 				networkIDStr = "rinkeby"
 			}
 			network, ok := param.Conf.Networks[networkIDStr]
 			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "network_id is invalid",
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
 				return
 			}
 
 			etherClient, ok := etherClients[networkIDStr]
 			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "network_id is invalid",
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
 				return
 			}
 
-			toAddressStr := c.Query("to_address")
-			if toAddressStr == "" {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "to_address is invalid",
-				}
-				c.JSON(http.StatusOK, result)
+			token, ok := network.GetToken(c.Query("token"))
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "token is invalid"))
 				return
 			}
-			valueFloat, err := strconv.ParseFloat(c.Query("value"), 64)
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+
+			ownerStr := c.Query("owner")
+			if !common.IsHexAddress(ownerStr) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "owner is invalid"))
 				return
 			}
+			owner := common.HexToAddress(ownerStr)
 
-			privateKeyStr := network.PrivateKey
-
-			privateKey, err := crypto.HexToECDSA(privateKeyStr)
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+			spenderStr := c.Query("spender")
+			if !common.IsHexAddress(spenderStr) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "spender is invalid"))
 				return
 			}
-			publicKey := privateKey.Public()
-			publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-			if !ok {
+			spender := common.HexToAddress(spenderStr)
+
+			cacheKey := "allowance:" + networkIDStr + ":" + strings.ToLower(token.Address) + ":" + strings.ToLower(owner.Hex()) + ":" + strings.ToLower(spender.Hex())
+			if data, ok := balanceCache.Get(cacheKey); ok {
 				result := map[string]interface{}{
-					"status":  -1,
-					"message": "error casting public key to ECDSA",
+					"status": 1,
+					"data":   data,
 				}
 				c.JSON(http.StatusOK, result)
 				return
 			}
 
-			fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-
-			nonce, err := etherClient.PendingNonceAt(context.Background(), fromAddress)
+			allowance, err := controller.GetTokenAllowance(etherClient, token, owner, spender)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, err)
 				return
 			}
-			if nonce > freeTokenNone {
-				freeEtherNone = nonce
-			} else {
-				freeEtherNone++
+
+			data := map[string]interface{}{
+				"network":       networkIDStr,
+				"token":         token.Symbol,
+				"token_address": token.Address,
+				"owner":         owner.Hex(),
+				"spender":       spender.Hex(),
+				"allowance":     controller.FormatAmount(allowance, token.Decimals),
+				"allowance_wei": allowance.String(),
 			}
+			balanceCache.Set(cacheKey, data)
 
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+			result := map[string]interface{}{
+				"status": 1,
+				"data":   data,
+			}
+			c.JSON(http.StatusOK, result)
+		})
+		index.GET("/tx", Authorize("GET /tx", false), func(c *gin.Context) {
+			userID, ok := c.Get("UserID")
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
 				return
 			}
-
-			value := big.NewInt(int64(valueFloat * 1e18))
-
-			gasLimit := uint64(100000) // in units
-			gasPrice, err := etherClient.SuggestGasPrice(context.Background())
-			gasPrice = big.NewInt(gasPrice.Int64() + int64(5*1e09))
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+			if userID.(int64) <= 0 {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
 				return
 			}
-			toAddress := common.HexToAddress(toAddressStr)
 
-			log.Printf("none : %d - %d", nonce, freeEtherNone)
-			tx := types.NewTransaction(freeEtherNone, toAddress, value, gasLimit, gasPrice, nil)
-			signedTx, err := types.SignTx(tx, types.HomesteadSigner{}, privateKey)
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
+			filter := dao.EthereumTransactionsFilter{
+				UserID:  userID.(int64),
+				Network: c.Query("network_id"),
+				RefType: c.Query("ref_type"),
+				Limit:   20,
+			}
+			var err error
+			if c.Query("ref_id") != "" {
+				filter.RefID, err = strconv.ParseInt(c.Query("ref_id"), 10, 64)
+				if err != nil {
+					respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "ref_id is invalid"))
+					return
 				}
-				c.JSON(http.StatusOK, result)
-				return
 			}
-			err = etherClient.SendTransaction(context.Background(), signedTx)
-			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
+			if c.Query("status") != "" {
+				status, err := strconv.Atoi(c.Query("status"))
+				if err != nil {
+					respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "status is invalid"))
+					return
+				}
+				filter.Status = &status
+			}
+			if c.Query("from_date") != "" {
+				fromDate, err := parseTimeParam(c.Query("from_date"))
+				if err != nil {
+					respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "from_date is invalid"))
+					return
+				}
+				filter.FromDate = &fromDate
+			}
+			if c.Query("to_date") != "" {
+				toDate, err := parseTimeParam(c.Query("to_date"))
+				if err != nil {
+					respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "to_date is invalid"))
+					return
+				}
+				filter.ToDate = &toDate
+			}
+			if c.Query("cursor") != "" {
+				filter.Cursor, err = strconv.ParseInt(c.Query("cursor"), 10, 64)
+				if err != nil {
+					respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "cursor is invalid"))
+					return
+				}
+			}
+			if c.Query("limit") != "" {
+				filter.Limit, err = strconv.Atoi(c.Query("limit"))
+				if err != nil || filter.Limit <= 0 || filter.Limit > 100 {
+					respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "limit is invalid"))
+					return
 				}
-				c.JSON(http.StatusOK, result)
-				return
 			}
 
-			ethTrans := models.EthereumTransactions{}
-			ethTrans.Hash = signedTx.Hash().Hex()
-			ethTrans.FromAddress = fromAddress.Hex()
-			ethTrans.ToAddress = toAddressStr
-			ethTrans.RefType = "user_free_ether"
-			ethTrans.RefID = userID.(int64)
-			ethTrans.UserID = userID.(int64)
-			ethTrans.Network = networkIDStr
-
-			_, err = controller.CreateEthereumTransaction(ethTrans)
+			ethTransList, err := controller.GetEthereumTransactions(filter)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, err)
 				return
 			}
-			txHash := signedTx.Hash().Hex()
-			log.Printf("hash : %s", txHash)
+			nextCursor := int64(0)
+			if len(ethTransList) == filter.Limit {
+				nextCursor = ethTransList[len(ethTransList)-1].ID
+			}
+
 			result := map[string]interface{}{
 				"status": 1,
 				"data": map[string]interface{}{
-					"from_address": fromAddress.Hex(),
-					"to_address":   toAddressStr,
-					"hash":         txHash,
-					"value":        valueFloat,
+					"items":       controller.NewEthereumTransactionViews(ethTransList),
+					"next_cursor": nextCursor,
 				},
 			}
 			c.JSON(http.StatusOK, result)
-			return
 		})
-
-		index.POST("/free-token", func(c *gin.Context) {
+		index.GET("/tx/:hash", Authorize("GET /tx/:hash", false), func(c *gin.Context) {
 			userID, ok := c.Get("UserID")
 			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "user is not logged in",
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
 				return
 			}
 			if userID.(int64) <= 0 {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "user is not logged in",
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
 				return
 			}
 
-			networkIDStr := c.Query("network_id")
-			if networkIDStr == "" {
-				networkIDStr = "rinkeby"
-			}
-			network, ok := param.Conf.Networks[networkIDStr]
-			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "network_id is invalid",
-				}
-				c.JSON(http.StatusOK, result)
+			ethTrans := controller.GetEthereumTransactionByHash(c.Param("hash"))
+			if ethTrans.ID <= 0 || ethTrans.UserID != userID.(int64) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeNotFound, "transaction is not found"))
 				return
 			}
 
-			etherClient, ok := etherClients[networkIDStr]
-			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "network_id is invalid",
+			data := map[string]interface{}{
+				"transaction": controller.NewEthereumTransactionView(ethTrans),
+			}
+			etherClient, ok := etherClients[ethTrans.Network]
+			if ethTrans.Status == -1 && ok {
+				ethTrans, receipt, err := controller.RefreshEthereumTransaction(etherClient, ethTrans)
+				if err != nil {
+					respondError(c, err)
+					return
 				}
-				c.JSON(http.StatusOK, result)
+				data["transaction"] = controller.NewEthereumTransactionView(ethTrans)
+				if receipt != nil {
+					data["receipt"] = receipt
+				} else {
+					_, isPending, err := etherClient.TransactionByHash(context.Background(), common.HexToHash(ethTrans.Hash))
+					data["pending"] = err == nil && isPending
+					data["found"] = err == nil
+				}
+			}
+
+			result := map[string]interface{}{
+				"status": 1,
+				"data":   data,
+			}
+			c.JSON(http.StatusOK, result)
+		})
+		index.GET("/contracts/:contract/:address/call/:method", Authorize("GET /contracts/:contract/:address/call/:method", true), func(c *gin.Context) {
+			networkIDStr := c.Query("network_id")
+			if networkIDStr == "" {
+				networkIDStr = "rinkeby"
+			}
+			etherClient, ok := etherClients[networkIDStr]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
 				return
 			}
 
-			toAddressStr := c.Query("to_address")
-			if toAddressStr == "" {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "to_address is invalid",
+			contract := c.Param("contract")
+			if _, ok := param.ABI_FILES[contract]; !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "contract is invalid"))
+				return
+			}
+			if !common.IsHexAddress(c.Param("address")) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "address is invalid"))
+				return
+			}
+			contractAddress := common.HexToAddress(c.Param("address"))
+
+			contractAbi, err := controller.LoadAbi(contract)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			method := c.Param("method")
+			abiMethod, ok := contractAbi.Methods[method]
+			if !ok || !abiMethod.Const {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "method is invalid"))
+				return
+			}
+
+			var blockNumber *big.Int
+			if c.Query("block") != "" && c.Query("block") != "latest" {
+				blockNumber, err = controller.ParseUint256(c.Query("block"))
+				if err != nil {
+					respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "block is invalid"))
+					return
 				}
-				c.JSON(http.StatusOK, result)
+			}
+
+			params := map[string]interface{}{}
+			for i, input := range abiMethod.Inputs {
+				name := input.Name
+				if name == "" {
+					name = fmt.Sprintf("arg%d", i)
+				}
+				values, ok := c.GetQueryArray(name)
+				if !ok {
+					continue
+				}
+				if input.Type.T == abi.SliceTy || input.Type.T == abi.ArrayTy {
+					items := []interface{}{}
+					for _, value := range values {
+						items = append(items, value)
+					}
+					params[name] = items
+				} else {
+					params[name] = values[0]
+				}
+			}
+			args, err := controller.ConvertArgs(contract, method, params)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
 				return
 			}
-			amountFloat, err := strconv.ParseFloat(c.Query("amount"), 64)
+
+			outputs, err := controller.CallContract(etherClient, contract, contractAddress, method, args, blockNumber)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
+				respondError(c, err)
+				return
+			}
+
+			result := map[string]interface{}{
+				"status": 1,
+				"data": map[string]interface{}{
+					"contract":         contract,
+					"contract_address": contractAddress.Hex(),
+					"method":           method,
+					"outputs":          outputs,
+				},
+			}
+			c.JSON(http.StatusOK, result)
+		})
+		index.POST("/contracts/:contract/:address/send/:method", Authorize("POST /contracts/:contract/:address/send/:method", true), IdempotencyMiddleware(), contractSendHandler)
+		index.POST("/tx", Authorize("POST /tx", false), IdempotencyMiddleware(), func(c *gin.Context) {
+
+			userID, ok := c.Get("UserID")
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+			if userID.(int64) <= 0 {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+
+			req := models.EthereumTransactions{}
+			err := c.Bind(&req)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+				return
+			}
+			network, ok := param.Conf.Networks[req.Network]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network is invalid"))
+				return
+			}
+			etherClient, ok := etherClients[req.Network]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network is invalid"))
+				return
+			}
+			identity, _ := c.Get("Identity")
+			err = auth.AuthorizeNetwork(param.Conf.Authorization, identity.(auth.Identity), req.Network)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeForbidden, err.Error()))
+				return
+			}
+			if _, err := hexutil.Decode(req.Hash); err != nil || len(req.Hash) != 66 {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "hash is invalid"))
+				return
+			}
+
+			// only the references come from the caller, the transaction itself is read from the chain
+			ethTrans := models.EthereumTransactions{
+				UserID:   userID.(int64),
+				Network:  req.Network,
+				Contract: req.Contract,
+				RefType:  req.RefType,
+				RefID:    req.RefID,
+				Hash:     req.Hash,
+			}
+			ethTrans, err = controller.VerifyEthereumTransaction(etherClient, ethTrans)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			if network.RequireRegisteredSender && !controller.IsUserWallet(userID.(int64), ethTrans.FromAddress) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeForbidden, "from_address is not a wallet of the user"))
+				return
+			}
+			ethTrans, err = controller.CreateEthereumTransaction(ethTrans)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			if ethTrans.UserID != userID.(int64) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "hash is already recorded by another user"))
+				return
+			}
+
+			result := map[string]interface{}{
+				"status":  1,
+				"message": "OK",
+				"data":    ethTrans,
+			}
+			c.JSON(http.StatusOK, result)
+		})
+		index.POST("/tx/raw", Authorize("POST /tx/raw", true), IdempotencyMiddleware(), func(c *gin.Context) {
+			userID, ok := c.Get("UserID")
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+			if userID.(int64) <= 0 {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+
+			networkIDStr := c.Query("network_id")
+			if networkIDStr == "" {
+				networkIDStr = "rinkeby"
+			}
+			dryRun := c.Query("dry_run") == "true"
+			network, ok := param.Conf.Networks[networkIDStr]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+				return
+			}
+			etherClient, ok := etherClients[networkIDStr]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+				return
+			}
+
+			req := struct {
+				Raw     string `json:"raw"`
+				RefType string `json:"ref_type"`
+				RefID   int64  `json:"ref_id"`
+			}{}
+			err := c.Bind(&req)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+				return
+			}
+			tx, err := controller.DecodeRawTransaction(req.Raw)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			chainID, err := controller.NetworkChainID(etherClient, network)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			err = controller.CheckRelayLimits(network.Relay, chainID, tx)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+
+			refType := req.RefType
+			if refType == "" {
+				refType = "user_relay"
+			}
+			ethTrans, err := controller.FillEthereumTransaction(models.EthereumTransactions{
+				UserID:  userID.(int64),
+				Network: networkIDStr,
+				RefType: refType,
+				RefID:   req.RefID,
+			}, tx)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			if network.RequireRegisteredSender && !controller.IsUserWallet(userID.(int64), ethTrans.FromAddress) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeForbidden, "from_address is not a wallet of the user"))
+				return
+			}
+
+			if dryRun {
+				estimatedGas, err := controller.SimulateTransaction(etherClient, ethereum.CallMsg{
+					From:     common.HexToAddress(ethTrans.FromAddress),
+					To:       tx.To(),
+					Gas:      tx.Gas(),
+					GasPrice: tx.GasPrice(),
+					Value:    tx.Value(),
+					Data:     tx.Data(),
+				})
+				if err != nil {
+					respondError(c, err)
+					return
 				}
-				c.JSON(http.StatusOK, result)
+				c.JSON(http.StatusOK, dryRunResult(common.HexToAddress(ethTrans.FromAddress), tx, estimatedGas))
+				return
+			}
+
+			err = etherClient.SendTransaction(context.Background(), tx)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			log.Printf("relay hash : %s", ethTrans.Hash)
+			ethTrans, err = controller.CreateEthereumTransaction(ethTrans)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+
+			result := map[string]interface{}{
+				"status": 1,
+				"data": map[string]interface{}{
+					"from_address": ethTrans.FromAddress,
+					"to_address":   ethTrans.ToAddress,
+					"hash":         ethTrans.Hash,
+					"nonce":        tx.Nonce(),
+					"value":        controller.FormatAmount(tx.Value(), 18),
+					"value_wei":    tx.Value().String(),
+				},
+			}
+			c.JSON(http.StatusOK, result)
+		})
+		index.POST("/transfer", Authorize("POST /transfer", true), IdempotencyMiddleware(), func(c *gin.Context) {
+			userID, ok := c.Get("UserID")
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+			if userID.(int64) <= 0 {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+
+			networkIDStr := c.Query("network_id")
+			if networkIDStr == "" {
+				networkIDStr = "rinkeby"
+			}
+			dryRun := c.Query("dry_run") == "true"
+
+			txService, ok := txServices[networkIDStr]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
 				return
 			}
 
-			privateKeyStr := network.PrivateKey
-			tokenAddressStr := network.TokenAddress
+			privateKeyStr := c.Query("private_key")
+			if privateKeyStr == "" {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "private_key is invalid"))
+				return
+			}
+			toAddressStr := c.Query("to_address")
+			if !common.IsHexAddress(toAddressStr) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "to_address is invalid"))
+				return
+			}
+			value, err := controller.ParseAmountParam(c.Query("value"), c.Query("value_wei"), 18)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+				return
+			}
 
 			privateKey, err := crypto.HexToECDSA(privateKeyStr)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "private_key is invalid"))
+				return
+			}
+
+			sent, err := txService.Send(txservice.Request{
+				PrivateKey: privateKey,
+				To:         common.HexToAddress(toAddressStr),
+				Value:      value,
+				GasLimit:   transferGasLimit,
+				DryRun:     dryRun,
+				Record: models.EthereumTransactions{
+					ToAddress: toAddressStr,
+					Value:     controller.AmountToFloat(value, 18),
+					RefType:   "user_transfer",
+					RefID:     userID.(int64),
+					UserID:    userID.(int64),
+				},
+			})
+			if err != nil {
+				respondSendError(c, err, sent.Record.Hash)
+				return
+			}
+			if dryRun {
+				c.JSON(http.StatusOK, dryRunResult(sent.From, sent.Transaction, sent.EstimatedGas))
+				return
+			}
+
+			result := map[string]interface{}{
+				"status": 1,
+				"data": map[string]interface{}{
+					"from_address": sent.From.Hex(),
+					"to_address":   toAddressStr,
+					"hash":         sent.Record.Hash,
+					"value":        controller.FormatAmount(value, 18),
+					"value_wei":    value.String(),
+				},
+			}
+			c.JSON(http.StatusOK, result)
+			return
+		})
+
+		index.POST("/transfer-token", Authorize("POST /transfer-token", true), IdempotencyMiddleware(), func(c *gin.Context) {
+			userID, ok := c.Get("UserID")
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
 				return
 			}
-			publicKey := privateKey.Public()
-			publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
+			if userID.(int64) <= 0 {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+
+			networkIDStr := c.Query("network_id")
+			if networkIDStr == "" {
+				networkIDStr = "rinkeby"
+			}
+			dryRun := c.Query("dry_run") == "true"
+			network, ok := param.Conf.Networks[networkIDStr]
 			if !ok {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": "error casting public key to ECDSA",
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+				return
+			}
+
+			txService, ok := txServices[networkIDStr]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
 				return
 			}
 
-			fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
+			token, ok := network.GetToken(c.Query("token"))
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "token is invalid"))
+				return
+			}
 
-			nonce, err := etherClient.PendingNonceAt(context.Background(), fromAddress)
+			privateKeyStr := c.Query("private_key")
+			if privateKeyStr == "" {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "private_key is invalid"))
+				return
+			}
+			toAddressStr := c.Query("to_address")
+			if !common.IsHexAddress(toAddressStr) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "to_address is invalid"))
+				return
+			}
+			amount, err := controller.ParseAmountParam(c.Query("amount"), c.Query("amount_wei"), token.Decimals)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
 				return
 			}
-			if nonce > freeTokenNone {
-				freeTokenNone = nonce
-			} else {
-				freeTokenNone++
+
+			privateKey, err := crypto.HexToECDSA(privateKeyStr)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "private_key is invalid"))
+				return
 			}
 
+			data, err := controller.PackERC20Transfer(common.HexToAddress(toAddressStr), amount)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, err)
 				return
 			}
 
-			value := big.NewInt(int64(0))
-			gasLimit := uint64(100000) // in units
-			gasPrice, err := etherClient.SuggestGasPrice(context.Background())
-			gasPrice = big.NewInt(gasPrice.Int64() + int64(5*1e09))
+			sent, err := txService.Send(txservice.Request{
+				PrivateKey: privateKey,
+				To:         common.HexToAddress(token.Address),
+				Data:       data,
+				GasLimit:   transferGasLimit,
+				DryRun:     dryRun,
+				Record: models.EthereumTransactions{
+					ToAddress: toAddressStr,
+					RefType:   "user_transfer_token",
+					RefID:     userID.(int64),
+					UserID:    userID.(int64),
+					Contract:  param.CONTRACT_ERC20,
+				},
+			})
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondSendError(c, err, sent.Record.Hash)
+				return
+			}
+			if dryRun {
+				c.JSON(http.StatusOK, dryRunResult(sent.From, sent.Transaction, sent.EstimatedGas))
 				return
 			}
 
-			toAddress := common.HexToAddress(toAddressStr)
-			tokenAddress := common.HexToAddress(tokenAddressStr)
+			result := map[string]interface{}{
+				"status": 1,
+				"data": map[string]interface{}{
+					"token":         token.Symbol,
+					"token_address": token.Address,
+					"from_address":  sent.From.Hex(),
+					"to_address":    toAddressStr,
+					"hash":          sent.Record.Hash,
+					"amount":        controller.FormatAmount(amount, token.Decimals),
+					"amount_wei":    amount.String(),
+				},
+			}
+			c.JSON(http.StatusOK, result)
+			return
+		})
 
-			transferFnSignature := []byte("transfer(address,uint256)")
-			hash := sha3.NewKeccak256()
-			hash.Write(transferFnSignature)
-			methodID := hash.Sum(nil)[:4]
+		index.POST("/free-ether", Authorize("POST /free-ether", true), IdempotencyMiddleware(), func(c *gin.Context) {
+			userID, ok := c.Get("UserID")
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+			if userID.(int64) <= 0 {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
 
-			paddedAddress := common.LeftPadBytes(toAddress.Bytes(), 32)
+			networkIDStr := c.Query("network_id")
+			if networkIDStr == "" {
+				networkIDStr = "rinkeby"
+			}
+			dryRun := c.Query("dry_run") == "true"
+			network, ok := param.Conf.Networks[networkIDStr]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+				return
+			}
 
-			amount := big.NewInt(0)
-			amount = amount.Mul(big.NewInt(int64(amountFloat)), big.NewInt(int64(1e18)))
+			txService, ok := txServices[networkIDStr]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+				return
+			}
 
-			paddedAmount := common.LeftPadBytes(amount.Bytes(), 32)
+			toAddressStr := c.Query("to_address")
+			if !common.IsHexAddress(toAddressStr) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "to_address is invalid"))
+				return
+			}
+			value, err := controller.ParseAmountParam(c.Query("value"), c.Query("value_wei"), 18)
+			if err != nil {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
+				return
+			}
 
-			var data []byte
-			data = append(data, methodID...)
-			data = append(data, paddedAddress...)
-			data = append(data, paddedAmount...)
+			privateKey, err := crypto.HexToECDSA(network.PrivateKey)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
 
-			// gasLimit, err = etherClient.EstimateGas(context.Background(), ethereum.CallMsg{
-			// 	To:   &toAddress,
-			// 	Data: data,
-			// })
+			// the reservation holds the request in the limits until the transaction is recorded
+			reservation := models.EthereumTransactions{}
+			if dryRun {
+				err = controller.CheckFaucetLimit(network.Faucet.Ether, networkIDStr, "user_free_ether", userID.(int64), toAddressStr, controller.AmountToFloat(value, 18))
+			} else {
+				reservation, err = controller.ReserveFaucet(network.Faucet.Ether, networkIDStr, "user_free_ether", userID.(int64), toAddressStr, controller.AmountToFloat(value, 18))
+			}
+			if err != nil {
+				respondError(c, err)
+				return
+			}
 
+			sent, err := txService.Send(txservice.Request{
+				PrivateKey:   privateKey,
+				To:           common.HexToAddress(toAddressStr),
+				Value:        value,
+				GasLimit:     transferGasLimit,
+				GasPriceBump: faucetGasPriceBump,
+				DryRun:       dryRun,
+				Record: models.EthereumTransactions{
+					ToAddress: toAddressStr,
+					Value:     controller.AmountToFloat(value, 18),
+					RefType:   "user_free_ether",
+					RefID:     userID.(int64),
+					UserID:    userID.(int64),
+				},
+			})
+			// a broadcast transaction which was not recorded keeps its reservation
+			if reservation.ID > 0 && (err == nil || sent.Record.Hash == "") {
+				controller.ReleaseFaucet(reservation)
+			}
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondSendError(c, err, sent.Record.Hash)
+				return
+			}
+			if dryRun {
+				c.JSON(http.StatusOK, dryRunResult(sent.From, sent.Transaction, sent.EstimatedGas))
+				return
+			}
+
+			result := map[string]interface{}{
+				"status": 1,
+				"data": map[string]interface{}{
+					"from_address": sent.From.Hex(),
+					"to_address":   toAddressStr,
+					"hash":         sent.Record.Hash,
+					"value":        controller.FormatAmount(value, 18),
+					"value_wei":    value.String(),
+				},
+			}
+			c.JSON(http.StatusOK, result)
+			return
+		})
+
+		index.POST("/free-token", Authorize("POST /free-token", true), IdempotencyMiddleware(), func(c *gin.Context) {
+			userID, ok := c.Get("UserID")
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+			if userID.(int64) <= 0 {
+				respondError(c, controller.NewAPIError(controller.ErrCodeUnauthorized, "user is not logged in"))
+				return
+			}
+
+			networkIDStr := c.Query("network_id")
+			if networkIDStr == "" {
+				networkIDStr = "rinkeby"
+			}
+			dryRun := c.Query("dry_run") == "true"
+			network, ok := param.Conf.Networks[networkIDStr]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+				return
+			}
+
+			txService, ok := txServices[networkIDStr]
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "network_id is invalid"))
+				return
+			}
+
+			toAddressStr := c.Query("to_address")
+			if !common.IsHexAddress(toAddressStr) {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "to_address is invalid"))
 				return
 			}
-			log.Printf("none : %d - %d", nonce, freeTokenNone)
-			tx := types.NewTransaction(freeTokenNone, tokenAddress, value, gasLimit, gasPrice, data)
-			signedTx, err := types.SignTx(tx, types.HomesteadSigner{}, privateKey)
+			token, ok := network.GetToken(c.Query("token"))
+			if !ok {
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, "token is invalid"))
+				return
+			}
+			amount, err := controller.ParseAmountParam(c.Query("amount"), c.Query("amount_wei"), token.Decimals)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, controller.NewAPIError(controller.ErrCodeInvalidParam, err.Error()))
 				return
 			}
 
-			err = etherClient.SendTransaction(context.Background(), signedTx)
+			privateKey, err := crypto.HexToECDSA(network.PrivateKey)
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, err)
 				return
 			}
 
-			ethTrans := models.EthereumTransactions{}
-			ethTrans.Hash = signedTx.Hash().Hex()
-			ethTrans.FromAddress = fromAddress.Hex()
-			ethTrans.ToAddress = toAddressStr
-			ethTrans.RefType = "user_free_token"
-			ethTrans.RefID = userID.(int64)
-			ethTrans.UserID = userID.(int64)
-			ethTrans.Network = networkIDStr
+			data, err := controller.PackERC20Transfer(common.HexToAddress(toAddressStr), amount)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
 
-			_, err = controller.CreateEthereumTransaction(ethTrans)
+			// the reservation holds the request in the limits until the transaction is recorded
+			refType := controller.FaucetTokenRefType(network, token)
+			reservation := models.EthereumTransactions{}
+			if dryRun {
+				err = controller.CheckFaucetLimit(network.Faucet.Token, networkIDStr, refType, userID.(int64), toAddressStr, controller.AmountToFloat(amount, token.Decimals))
+			} else {
+				reservation, err = controller.ReserveFaucet(network.Faucet.Token, networkIDStr, refType, userID.(int64), toAddressStr, controller.AmountToFloat(amount, token.Decimals))
+			}
 			if err != nil {
-				result := map[string]interface{}{
-					"status":  -1,
-					"message": err.Error(),
-				}
-				c.JSON(http.StatusOK, result)
+				respondError(c, err)
+				return
+			}
+
+			sent, err := txService.Send(txservice.Request{
+				PrivateKey:   privateKey,
+				To:           common.HexToAddress(token.Address),
+				Data:         data,
+				GasLimit:     transferGasLimit,
+				GasPriceBump: faucetGasPriceBump,
+				DryRun:       dryRun,
+				Record: models.EthereumTransactions{
+					ToAddress: toAddressStr,
+					Value:     controller.AmountToFloat(amount, token.Decimals),
+					RefType:   refType,
+					Contract:  param.CONTRACT_ERC20,
+					RefID:     userID.(int64),
+					UserID:    userID.(int64),
+				},
+			})
+			// a broadcast transaction which was not recorded keeps its reservation
+			if reservation.ID > 0 && (err == nil || sent.Record.Hash == "") {
+				controller.ReleaseFaucet(reservation)
+			}
+			if err != nil {
+				respondSendError(c, err, sent.Record.Hash)
+				return
+			}
+			if dryRun {
+				c.JSON(http.StatusOK, dryRunResult(sent.From, sent.Transaction, sent.EstimatedGas))
 				return
 			}
-			txHash := signedTx.Hash().Hex()
-			log.Printf("hash : %s", txHash)
+
 			result := map[string]interface{}{
 				"status": 1,
 				"data": map[string]interface{}{
-					"token_address": tokenAddressStr,
-					"from_address":  fromAddress.Hex(),
+					"token":         token.Symbol,
+					"token_address": token.Address,
+					"from_address":  sent.From.Hex(),
 					"to_address":    toAddressStr,
-					"hash":          txHash,
-					"amount":        amountFloat,
+					"hash":          sent.Record.Hash,
+					"amount":        controller.FormatAmount(amount, token.Decimals),
+					"amount_wei":    amount.String(),
 				},
 			}
 			c.JSON(http.StatusOK, result)
@@ -726,31 +1207,242 @@ func serviceApp() error {
 		})
 	}
 
+	payable := router.Group("/payable", Authorize("POST /payable", true), IdempotencyMiddleware())
+	{
+		payable.POST("/init", payableHandler("init"))
+		payable.POST("/init-by-payer", payableHandler("initByPayer"))
+		payable.POST("/shake", payableHandler("shake"))
+		payable.POST("/deliver", payableHandler("deliver"))
+		payable.POST("/withdraw", payableHandler("withdraw"))
+		payable.POST("/reject", payableHandler("reject"))
+		payable.POST("/accept", payableHandler("accept"))
+		payable.POST("/cancel", payableHandler("cancel"))
+	}
+	router.POST("/meta-tx", Authorize("POST /meta-tx", true), IdempotencyMiddleware(), metaTxHandler)
+	router.GET("/handshakes", Authorize("GET /handshakes", false), getHandshakesHandler)
+	router.GET("/handshakes/:chain/:contract/:hid", Authorize("GET /handshakes/:chain/:contract/:hid", false), getHandshakeHandler)
+	router.POST("/transfers/batch", Authorize("POST /transfers/batch", true), IdempotencyMiddleware(), transferBatchHandler)
+	router.GET("/transfers/batch/:id", Authorize("GET /transfers/batch/:id", false), getTransferBatchHandler)
+	crowdsale := router.Group("/crowdsale", Authorize("POST /crowdsale", true), IdempotencyMiddleware())
+	{
+		crowdsale.POST("/init", crowdsaleHandler("initCrowdsale"))
+		crowdsale.POST("/shake", crowdsaleHandler("shake"))
+		crowdsale.POST("/unshake", crowdsaleHandler("unshake"))
+		crowdsale.POST("/cancel", crowdsaleHandler("cancel"))
+		crowdsale.POST("/stop", crowdsaleHandler("stop"))
+		crowdsale.POST("/refund", crowdsaleHandler("refund"))
+		crowdsale.POST("/withdraw", crowdsaleHandler("withdraw"))
+	}
+
 	router.Run(":8080")
 
 	return nil
 }
 
+// parseTimeParam accepts either a unix timestamp or a RFC3339 date
+func parseTimeParam(str string) (time.Time, error) {
+	timestamp, err := strconv.ParseInt(str, 10, 64)
+	if err == nil {
+		return time.Unix(timestamp, 0), nil
+	}
+	return time.Parse(time.RFC3339, str)
+}
+
 func Logger() gin.HandlerFunc {
 	return func(context *gin.Context) {
 		t := time.Now()
 		context.Next()
 		status := context.Writer.Status()
 		latency := time.Since(t)
-		log.Print("Request: " + context.Request.URL.String() + " | " + context.Request.Method + " - Status: " + strconv.Itoa(status) + " - " +
+		log.Print("Request: " + context.Writer.Header().Get("X-Request-Id") + " " + context.Request.URL.String() + " | " + context.Request.Method + " - Status: " + strconv.Itoa(status) + " - " +
 			latency.String())
 	}
 }
 
-func AuthorizeMiddleware() gin.HandlerFunc {
+// RequestID sets the RequestID of the request, a valid X-Request-Id header from the caller is kept
+func RequestID() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		requestID := context.GetHeader("X-Request-Id")
+		if !requestIDRegexp.MatchString(requestID) {
+			b := make([]byte, 16)
+			rand.Read(b)
+			requestID = hex.EncodeToString(b)
+		}
+		context.Set("RequestID", requestID)
+		context.Header("X-Request-Id", requestID)
+		context.Next()
+	}
+}
+
+// respondError writes the typed error envelope with the http status of the error code,
+// the former envelope with http 200 is written when legacy_errors is configured or asked by the X-Legacy-Errors header
+func respondError(context *gin.Context, err error) {
+	apiErr := controller.ToAPIError(err)
+	if param.Conf.LegacyErrors || context.GetHeader("X-Legacy-Errors") == "true" {
+		status := -1
+		if apiErr.Code == controller.ErrCodeUnauthorized {
+			status = 0
+		}
+		result := map[string]interface{}{
+			"status":  status,
+			"message": apiErr.Message,
+		}
+		if apiErr.RetryAfter > 0 {
+			result["retry_after"] = int64(apiErr.RetryAfter.Seconds())
+		}
+		if data, ok := context.Get("ErrorData"); ok {
+			result["data"] = data
+		}
+		context.JSON(http.StatusOK, result)
+		return
+	}
+
+	errorData := map[string]interface{}{
+		"code":    apiErr.Code,
+		"message": apiErr.Message,
+	}
+	if apiErr.RetryAfter > 0 {
+		retryAfter := int64(apiErr.RetryAfter.Seconds())
+		errorData["retry_after"] = retryAfter
+		context.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	}
+	result := map[string]interface{}{
+		"status":     -1,
+		"error":      errorData,
+		"request_id": context.Writer.Header().Get("X-Request-Id"),
+	}
+	if data, ok := context.Get("ErrorData"); ok {
+		result["data"] = data
+	}
+	context.JSON(apiErr.HTTPStatus(), result)
+}
+
+// respondSendError responds the error of a send, the hash of a transaction which was broadcast is returned
+// so the caller does not send it again and IdempotencyMiddleware keeps the key
+func respondSendError(context *gin.Context, err error, hash string) {
+	if hash != "" {
+		context.Set("ErrorData", map[string]interface{}{
+			"hash": hash,
+		})
+	}
+	respondError(context, err)
+}
+
+// AuthorizeMiddleware sets the UserID and Scopes of the caller found by the configured authenticators
+func AuthorizeMiddleware(authenticators []auth.Authenticator) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		identity, err := auth.Authenticate(authenticators, context.Request)
+		if err != nil {
+			respondError(context, controller.NewAPIError(controller.ErrCodeUnauthorized, err.Error()))
+			context.Abort()
+			return
+		}
+		context.Set("UserID", identity.UserID)
+		context.Set("Scopes", identity.Scopes)
+		context.Set("Identity", *identity)
+		context.Next()
+	}
+}
+
+// Authorize checks the scopes required by the route and, for routes using a network, the allow list of the network
+func Authorize(route string, networkBound bool) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		value, ok := context.Get("Identity")
+		if !ok {
+			respondError(context, controller.NewAPIError(controller.ErrCodeUnauthorized, auth.ErrUnauthorized.Error()))
+			context.Abort()
+			return
+		}
+		identity := value.(auth.Identity)
+		err := auth.AuthorizeRoute(param.Conf.Authorization, identity, route)
+		if err == nil && networkBound {
+			networkIDStr := context.Query("network_id")
+			if networkIDStr == "" {
+				networkIDStr = "rinkeby"
+			}
+			err = auth.AuthorizeNetwork(param.Conf.Authorization, identity, networkIDStr)
+		}
+		if err != nil {
+			respondError(context, controller.NewAPIError(controller.ErrCodeForbidden, err.Error()))
+			context.Abort()
+			return
+		}
+		context.Next()
+	}
+}
+
+type bodyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (writer bodyWriter) Write(b []byte) (int, error) {
+	writer.body.Write(b)
+	return writer.ResponseWriter.Write(b)
+}
+
+func (writer bodyWriter) WriteString(s string) (int, error) {
+	writer.body.WriteString(s)
+	return writer.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware replays the stored response of a POST request retried with the same Idempotency-Key header,
+// it runs after Authorize so requests which are not allowed never reserve a key
+func IdempotencyMiddleware() gin.HandlerFunc {
 	return func(context *gin.Context) {
-		userID, _ := strconv.ParseInt(context.GetHeader("Uid"), 10, 64)
-		if userID <= 0 {
-			context.JSON(http.StatusOK, gin.H{"status": 0, "message": "User is not authorized"})
+		key := context.GetHeader("Idempotency-Key")
+		if context.Request.Method != http.MethodPost || key == "" || context.Query("dry_run") == "true" {
+			context.Next()
+			return
+		}
+		body, err := ioutil.ReadAll(context.Request.Body)
+		if err != nil {
+			respondError(context, err)
 			context.Abort()
 			return
 		}
-		context.Set("UserID", userID)
+		context.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		hash.Write([]byte(context.Request.Method + " " + context.Request.URL.String() + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		userID, _ := context.Get("UserID")
+		idempotencyKey, replay, err := controller.BeginIdempotentRequest(userID.(int64), key, fingerprint)
+		if err != nil {
+			respondError(context, err)
+			context.Abort()
+			return
+		}
+		if replay {
+			context.Header("Idempotent-Replayed", "true")
+			context.Data(idempotencyKey.StatusCode, "application/json; charset=utf-8", []byte(idempotencyKey.Response))
+			context.Abort()
+			return
+		}
+
+		writer := bodyWriter{ResponseWriter: context.Writer, body: &bytes.Buffer{}}
+		context.Writer = writer
+		finished := false
+		defer func() {
+			if finished {
+				return
+			}
+			// the handler panicked, the key is released unless a hash was already written
+			recovered := recover()
+			err := controller.FinishIdempotentRequest(idempotencyKey, writer.Status(), writer.body.Bytes())
+			if err != nil {
+				log.Println("IdempotencyMiddleware", err)
+			}
+			if recovered != nil {
+				panic(recovered)
+			}
+		}()
 		context.Next()
+		finished = true
+		err = controller.FinishIdempotentRequest(idempotencyKey, writer.Status(), writer.body.Bytes())
+		if err != nil {
+			log.Println("IdempotencyMiddleware", err)
+		}
 	}
 }
@@ -0,0 +1,48 @@
+-- a deposit is stored once per log, a concurrent scan fails on the unique key and skips it, the log index
+-- of an ether transfer is -1
+CREATE TABLE IF NOT EXISTS `deposits` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `user_id` bigint(20) NOT NULL,
+  `network` varchar(64) NOT NULL,
+  `address` varchar(42) NOT NULL,
+  `from_address` varchar(42) NOT NULL,
+  `asset` varchar(64) NOT NULL,
+  `token_address` varchar(42) NOT NULL DEFAULT '',
+  `amount` varchar(80) NOT NULL,
+  `hash` varchar(66) NOT NULL,
+  `block_number` bigint(20) NOT NULL,
+  `log_index` bigint(20) NOT NULL,
+  `confirmations` bigint(20) NOT NULL DEFAULT 0,
+  `status` int(11) NOT NULL DEFAULT 0,
+  `pubsub_msg_id` varchar(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `deposits_network_hash_log_index` (`network`, `hash`, `log_index`),
+  KEY `deposits_network_status` (`network`, `status`),
+  KEY `deposits_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- the last block scanned for deposits per network
+CREATE TABLE IF NOT EXISTS `deposit_scans` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `network` varchar(64) NOT NULL,
+  `block_number` bigint(20) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `deposit_scans_network` (`network`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- an address is watched for one user per network, a concurrent request fails on the unique key
+CREATE TABLE IF NOT EXISTS `watched_addresses` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `user_id` bigint(20) NOT NULL,
+  `network` varchar(64) NOT NULL,
+  `address` varchar(42) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `watched_addresses_network_address` (`network`, `address`),
+  KEY `watched_addresses_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+-- the ether sent with the transactions of the logs, the handshakes are rebuilt without calling the node,
+-- run the backfill-handshakes command once it is added
+ALTER TABLE `ethereum_logs` ADD COLUMN `value` varchar(78) NOT NULL DEFAULT '';
@@ -0,0 +1,24 @@
+-- the handshakes projected from ethereum_logs, hid is the uint256 id of the handshake in decimal
+CREATE TABLE IF NOT EXISTS `handshakes` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `chain_id` int(11) NOT NULL,
+  `contract` varchar(64) NOT NULL,
+  `contract_address` varchar(42) NOT NULL,
+  `hid` varchar(78) NOT NULL,
+  `state` varchar(32) NOT NULL DEFAULT '',
+  `state_code` int(11) NOT NULL DEFAULT 0,
+  `payer` varchar(42) NOT NULL DEFAULT '',
+  `payee` varchar(42) NOT NULL DEFAULT '',
+  `balance` varchar(78) NOT NULL DEFAULT '0',
+  `offchain` varchar(255) NOT NULL DEFAULT '',
+  `event` varchar(64) NOT NULL DEFAULT '',
+  `hash` varchar(66) NOT NULL DEFAULT '',
+  `block_number` bigint(20) NOT NULL DEFAULT 0,
+  `log_index` bigint(20) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `handshakes_chain_id_contract_address_hid` (`chain_id`, `contract_address`, `hid`),
+  KEY `handshakes_payer` (`payer`),
+  KEY `handshakes_payee` (`payee`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
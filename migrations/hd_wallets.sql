@@ -0,0 +1,15 @@
+-- the deposit address of a user is derived once per network, a concurrent first request fails on the
+-- unique key and reads the address stored by the other one
+CREATE TABLE IF NOT EXISTS `hd_wallets` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `user_id` bigint(20) NOT NULL,
+  `network` varchar(64) NOT NULL,
+  `derivation_path` varchar(255) NOT NULL,
+  `derivation_index` bigint(20) NOT NULL,
+  `address` varchar(42) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `hd_wallets_network_user_id` (`network`, `user_id`),
+  UNIQUE KEY `hd_wallets_network_address` (`network`, `address`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,19 @@
+-- a retried request reserves its Idempotency-Key with an insert, the unique key makes the
+-- concurrent retries fail instead of running the request twice
+CREATE TABLE IF NOT EXISTS `idempotency_keys` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `user_id` bigint(20) NOT NULL,
+  `key` varchar(255) NOT NULL,
+  `fingerprint` varchar(64) NOT NULL,
+  `status_code` int(11) NOT NULL DEFAULT 0,
+  `response` mediumtext,
+  `hash` varchar(66) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idempotency_keys_user_id_key` (`user_id`, `key`),
+  KEY `idempotency_keys_date_created` (`date_created`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- for an existing table
+-- ALTER TABLE `idempotency_keys` ADD UNIQUE KEY `idempotency_keys_user_id_key` (`user_id`, `key`);
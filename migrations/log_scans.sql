@@ -0,0 +1,12 @@
+-- the last block scanned for the logs of an event of a contract, a paged scan resumes from it after a restart
+CREATE TABLE IF NOT EXISTS `log_scans` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `chain_id` int(11) NOT NULL,
+  `contract_address` varchar(42) NOT NULL,
+  `event` varchar(64) NOT NULL,
+  `block_number` bigint(20) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `log_scans_chain_id_contract_address_event` (`chain_id`, `contract_address`, `event`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,20 @@
+-- an intent reserves its nonce with an insert before it is relayed, the unique key makes a
+-- second relay of the same nonce fail instead of sending it twice
+CREATE TABLE IF NOT EXISTS `meta_transactions` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `user_id` bigint(20) NOT NULL,
+  `network` varchar(64) NOT NULL,
+  `from_address` varchar(42) NOT NULL,
+  `nonce` bigint(20) NOT NULL,
+  `contract` varchar(64) NOT NULL DEFAULT '',
+  `method` varchar(64) NOT NULL DEFAULT '',
+  `hash` varchar(66) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `meta_transactions_network_from_address_nonce` (`network`, `from_address`, `nonce`),
+  KEY `meta_transactions_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- for an existing table
+-- ALTER TABLE `meta_transactions` ADD UNIQUE KEY `meta_transactions_network_from_address_nonce` (`network`, `from_address`, `nonce`);
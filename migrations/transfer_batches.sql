@@ -0,0 +1,32 @@
+-- the batches of POST /transfers/batch, the items are stored with their nonces and hashes
+-- before they are broadcast
+CREATE TABLE IF NOT EXISTS `transfer_batches` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `user_id` bigint(20) NOT NULL,
+  `network` varchar(64) NOT NULL,
+  `from_address` varchar(42) NOT NULL,
+  `item_count` int(11) NOT NULL DEFAULT 0,
+  `failed_count` int(11) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  KEY `transfer_batches_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `transfer_batch_items` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `batch_id` bigint(20) NOT NULL,
+  `item_index` int(11) NOT NULL,
+  `to_address` varchar(42) NOT NULL,
+  `asset` varchar(32) NOT NULL,
+  `token_address` varchar(42) NOT NULL DEFAULT '',
+  `amount` varchar(78) NOT NULL,
+  `ref_id` bigint(20) NOT NULL DEFAULT 0,
+  `nonce` int(11) NOT NULL DEFAULT 0,
+  `hash` varchar(66) NOT NULL DEFAULT '',
+  `error` varchar(1024) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `transfer_batch_items_batch_id_item_index` (`batch_id`, `item_index`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
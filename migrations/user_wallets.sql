@@ -0,0 +1,11 @@
+-- the wallets registered by the users, POST /tx only accepts their transactions when the network
+-- sets require_registered_sender
+CREATE TABLE IF NOT EXISTS `user_wallets` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `date_created` datetime NOT NULL,
+  `date_modified` datetime NOT NULL,
+  `user_id` bigint(20) NOT NULL,
+  `address` varchar(42) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `user_wallets_user_id_address` (`user_id`, `address`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+// Deposits are the transfers received by the watched addresses, network + hash + log_index is unique,
+// the log index of an ether transfer is -1
+type Deposits struct {
+	DateCreated   time.Time `json:"date_created"`
+	DateModified  time.Time `json:"date_modified"`
+	ID            int64     `json:"id"`
+	UserID        int64     `json:"user_id"`
+	Network       string    `json:"network"`
+	Address       string    `json:"address"`
+	FromAddress   string    `json:"from_address"`
+	Asset         string    `json:"asset"`
+	TokenAddress  string    `json:"token_address"`
+	Amount        string    `json:"amount_wei"`
+	Hash          string    `json:"hash"`
+	BlockNumber   int64     `json:"block_number"`
+	LogIndex      int64     `json:"log_index"`
+	Confirmations int64     `json:"confirmations"`
+	// Status is 0 until the deposit has enough confirmations, 1 once it has and -1 when it left the chain
+	Status      int    `json:"status"`
+	PubsubMsgId string `json:"-"`
+}
+
+func (Deposits) TableName() string {
+	return "deposits"
+}
+
+// DepositScans keep the last block scanned for deposits per network
+type DepositScans struct {
+	DateCreated  time.Time
+	DateModified time.Time
+	ID           int64
+	Network      string
+	BlockNumber  int64
+}
+
+func (DepositScans) TableName() string {
+	return "deposit_scans"
+}
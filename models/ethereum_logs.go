@@ -20,6 +20,8 @@ type EthereumLogs struct {
 	Hash            string
 	Data            string
 	PubsubMsgId     string
+	// Value is the ether in wei sent with the transaction of the log, it is empty for the logs stored before it was recorded
+	Value           string
 }
 
 func (EthereumLogs) TableName() string {
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+// Handshakes are the current states of the handshakes projected from ethereum_logs,
+// chain_id + contract_address + hid is unique
+type Handshakes struct {
+	DateCreated     time.Time `json:"date_created"`
+	DateModified    time.Time `json:"date_modified"`
+	ID              int64     `json:"id"`
+	ChainID         int       `json:"chain_id"`
+	Contract        string    `json:"contract"`
+	ContractAddress string    `json:"contract_address"`
+	// Hid is the uint256 id of the handshake in decimal
+	Hid   string `json:"hid"`
+	State string `json:"state"`
+	// StateCode is the state emitted by the crowdsale events
+	StateCode int    `json:"state_code"`
+	Payer     string `json:"payer"`
+	Payee     string `json:"payee"`
+	Balance   string `json:"balance_wei"`
+	Offchain  string `json:"offchain"`
+	// Event, Hash, BlockNumber and LogIndex are the log of the last transition
+	Event       string `json:"event"`
+	Hash        string `json:"hash"`
+	BlockNumber int64  `json:"block_number"`
+	LogIndex    int64  `json:"log_index"`
+}
+
+func (Handshakes) TableName() string {
+	return "handshakes"
+}
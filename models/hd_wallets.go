@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+// HDWallets are the deposit addresses derived for the users, network + user_id is unique
+type HDWallets struct {
+	DateCreated     time.Time `json:"date_created"`
+	DateModified    time.Time `json:"date_modified"`
+	ID              int64     `json:"id"`
+	UserID          int64     `json:"user_id"`
+	Network         string    `json:"network"`
+	DerivationPath  string    `json:"derivation_path"`
+	DerivationIndex int64     `json:"derivation_index"`
+	Address         string    `json:"address"`
+}
+
+func (HDWallets) TableName() string {
+	return "hd_wallets"
+}
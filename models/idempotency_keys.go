@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+type IdempotencyKeys struct {
+	DateCreated  time.Time
+	DateModified time.Time
+	ID           int64
+	UserID       int64
+	Key          string
+	Fingerprint  string
+	StatusCode   int
+	Response     string
+	Hash         string
+}
+
+func (IdempotencyKeys) TableName() string {
+	return "idempotency_keys"
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+// LogScans keep the last block scanned for the logs of an event of a contract, the paged scans resume from it
+type LogScans struct {
+	DateCreated     time.Time
+	DateModified    time.Time
+	ID              int64
+	ChainID         int
+	ContractAddress string
+	Event           string
+	BlockNumber     int64
+}
+
+func (LogScans) TableName() string {
+	return "log_scans"
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+// MetaTransactions are the intents relayed for the users, network + from_address + nonce is unique
+type MetaTransactions struct {
+	DateCreated  time.Time `json:"date_created"`
+	DateModified time.Time `json:"date_modified"`
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"user_id"`
+	Network      string    `json:"network"`
+	FromAddress  string    `json:"from_address"`
+	Nonce        int64     `json:"nonce"`
+	Contract     string    `json:"contract"`
+	Method       string    `json:"method"`
+	Hash         string    `json:"hash"`
+}
+
+func (MetaTransactions) TableName() string {
+	return "meta_transactions"
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+type TransferBatches struct {
+	DateCreated  time.Time `json:"date_created"`
+	DateModified time.Time `json:"date_modified"`
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"user_id"`
+	Network      string    `json:"network"`
+	FromAddress  string    `json:"from_address"`
+	ItemCount    int       `json:"item_count"`
+	FailedCount  int       `json:"failed_count"`
+}
+
+func (TransferBatches) TableName() string {
+	return "transfer_batches"
+}
+
+// TransferBatchItems are the transfers of a batch, Amount is in the smallest unit of the asset
+type TransferBatchItems struct {
+	DateCreated  time.Time `json:"date_created"`
+	DateModified time.Time `json:"date_modified"`
+	ID           int64     `json:"id"`
+	BatchID      int64     `json:"batch_id"`
+	ItemIndex    int       `json:"item_index"`
+	ToAddress    string    `json:"to_address"`
+	Asset        string    `json:"asset"`
+	TokenAddress string    `json:"token_address"`
+	Amount       string    `json:"amount_wei"`
+	RefID        int64     `json:"ref_id"`
+	Nonce        int       `json:"nonce"`
+	Hash         string    `json:"hash"`
+	Error        string    `json:"error"`
+}
+
+func (TransferBatchItems) TableName() string {
+	return "transfer_batch_items"
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+type UserWallets struct {
+	DateCreated  time.Time `json:"date_created"`
+	DateModified time.Time `json:"date_modified"`
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"user_id"`
+	Address      string    `json:"address"`
+}
+
+func (UserWallets) TableName() string {
+	return "user_wallets"
+}
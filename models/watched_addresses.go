@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	_ "github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+// WatchedAddresses are the addresses the deposit scanner looks for, network + address is unique
+type WatchedAddresses struct {
+	DateCreated  time.Time `json:"date_created"`
+	DateModified time.Time `json:"date_modified"`
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"user_id"`
+	Network      string    `json:"network"`
+	Address      string    `json:"address"`
+}
+
+func (WatchedAddresses) TableName() string {
+	return "watched_addresses"
+}
@@ -0,0 +1,252 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ninjadotorg/handshake-ethereum/controller"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+	"github.com/ninjadotorg/handshake-ethereum/txservice"
+)
+
+const (
+	TopUpRefType      = "top_up"
+	TopUpTokenRefType = "top_up_token"
+)
+
+// Monitor checks the balances of the operator accounts of a network, the accounts below the
+// thresholds are reported to the sink and topped up from the treasury
+type Monitor struct {
+	Network  string
+	Conf     param.Network
+	Client   *ethclient.Client
+	Service  *txservice.Service
+	Sink     Sink
+	Interval time.Duration
+
+	mutex   sync.Mutex
+	running bool
+	alerted map[string]time.Time
+}
+
+func New(network string, conf param.Network, client *ethclient.Client, sink Sink, interval time.Duration) *Monitor {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &Monitor{
+		Network:  network,
+		Conf:     conf,
+		Client:   client,
+		Service:  controller.NewTxService(network, client),
+		Sink:     sink,
+		Interval: interval,
+		alerted:  map[string]time.Time{},
+	}
+}
+
+// Check checks every operator account, it returns at once when the previous check is still running
+func (monitor *Monitor) Check() {
+	monitor.mutex.Lock()
+	if monitor.running {
+		monitor.mutex.Unlock()
+		return
+	}
+	monitor.running = true
+	monitor.mutex.Unlock()
+	defer func() {
+		monitor.mutex.Lock()
+		monitor.running = false
+		monitor.mutex.Unlock()
+	}()
+
+	operators := monitor.Conf.Operators
+	treasury := operators.Treasury
+	for _, address := range monitor.operators() {
+		monitor.check(address, nil, operators.MinEther, treasury.TargetEther, treasury.DailyEther)
+		for _, token := range monitor.Conf.GetTokens() {
+			token := token
+			monitor.check(address, &token, operators.MinTokens[token.Symbol], treasury.TargetTokens[token.Symbol], treasury.DailyTokens[token.Symbol])
+		}
+	}
+}
+
+// operators returns the key of the network, the meta tx relayer and the configured addresses
+func (monitor *Monitor) operators() []common.Address {
+	addresses := []common.Address{}
+	seen := map[common.Address]bool{}
+	add := func(address common.Address) {
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	for _, key := range []string{monitor.Conf.PrivateKey, monitor.Conf.MetaTx.PrivateKey} {
+		if key == "" {
+			continue
+		}
+		privateKey, err := crypto.HexToECDSA(key)
+		if err != nil {
+			log.Println("Monitor.operators()", monitor.Network, err)
+			continue
+		}
+		add(crypto.PubkeyToAddress(privateKey.PublicKey))
+	}
+	for _, address := range monitor.Conf.Operators.Addresses {
+		if !common.IsHexAddress(address) {
+			log.Println("Monitor.operators()", monitor.Network, "address is invalid", address)
+			continue
+		}
+		add(common.HexToAddress(address))
+	}
+	return addresses
+}
+
+// check compares the ether balance of address, or its balance of token, with min
+func (monitor *Monitor) check(address common.Address, token *param.Token, min float64, target float64, daily float64) {
+	if min <= 0 {
+		return
+	}
+	asset := "ETH"
+	decimals := 18
+	if token != nil {
+		asset = token.Symbol
+		decimals = token.Decimals
+	}
+	threshold, err := controller.FloatToAmount(min, decimals)
+	if err != nil {
+		log.Println("Monitor.check()", monitor.Network, asset, err)
+		return
+	}
+	var balance *big.Int
+	if token == nil {
+		balance, err = monitor.Client.BalanceAt(context.Background(), address, nil)
+	} else {
+		balance, err = controller.GetTokenBalance(monitor.Client, *token, address)
+	}
+	if err != nil {
+		log.Println("Monitor.check()", monitor.Network, asset, err)
+		return
+	}
+
+	key := strings.ToLower(address.Hex()) + ":" + asset
+	if balance.Cmp(threshold) >= 0 {
+		monitor.mutex.Lock()
+		delete(monitor.alerted, key)
+		monitor.mutex.Unlock()
+		return
+	}
+
+	alert := Alert{
+		Network:   monitor.Network,
+		Address:   address.Hex(),
+		Asset:     asset,
+		Balance:   controller.FormatAmount(balance, decimals),
+		Threshold: controller.FormatAmount(threshold, decimals),
+	}
+	monitor.topUp(&alert, address, token, decimals, balance, target, daily)
+
+	// an alert is repeated after the interval unless the account was topped up
+	monitor.mutex.Lock()
+	lastTime, ok := monitor.alerted[key]
+	if ok && alert.TopUpHash == "" && alert.TopUpError == "" && lastTime.Add(monitor.Interval).After(time.Now()) {
+		monitor.mutex.Unlock()
+		return
+	}
+	monitor.alerted[key] = time.Now()
+	monitor.mutex.Unlock()
+
+	err = monitor.Sink.Send(alert)
+	if err != nil {
+		log.Println("Monitor.check()", monitor.Network, asset, err)
+	}
+}
+
+// topUp sends the treasury funds to bring the balance of address to target within the daily limit
+func (monitor *Monitor) topUp(alert *Alert, address common.Address, token *param.Token, decimals int, balance *big.Int, target float64, daily float64) {
+	treasury := monitor.Conf.Operators.Treasury
+	if treasury.PrivateKey == "" || target <= 0 || daily <= 0 {
+		return
+	}
+	privateKey, err := crypto.HexToECDSA(treasury.PrivateKey)
+	if err != nil {
+		alert.TopUpError = "treasury private key is invalid"
+		return
+	}
+	treasuryAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	if treasuryAddress == address {
+		return
+	}
+
+	refType := TopUpRefType
+	if token != nil {
+		refType = TopUpTokenRefType + "_" + strings.ToLower(token.Symbol)
+	}
+	cooldown := time.Duration(treasury.Cooldown) * time.Second
+	if cooldown <= 0 {
+		cooldown = 10 * time.Minute
+	}
+	// the previous top-up may not be mined yet
+	lastTopUp := controller.LastTopUp(monitor.Network, refType, address.Hex())
+	if lastTopUp.ID > 0 && lastTopUp.DateCreated.Add(cooldown).After(time.Now()) {
+		return
+	}
+
+	targetAmount, err := controller.FloatToAmount(target, decimals)
+	if err != nil {
+		alert.TopUpError = err.Error()
+		return
+	}
+	amount := new(big.Int).Sub(targetAmount, balance)
+	if amount.Sign() <= 0 {
+		return
+	}
+	remaining, err := controller.TopUpRemaining(monitor.Network, refType, treasuryAddress.Hex(), daily, decimals)
+	if err != nil {
+		alert.TopUpError = err.Error()
+		return
+	}
+	if amount.Cmp(remaining) > 0 {
+		amount = remaining
+	}
+	if amount.Sign() <= 0 {
+		alert.TopUpError = "daily top-up limit is reached"
+		return
+	}
+
+	req := txservice.Request{
+		PrivateKey: privateKey,
+		To:         address,
+		Value:      amount,
+		Record: models.EthereumTransactions{
+			ToAddress: address.Hex(),
+			Value:     controller.AmountToFloat(amount, decimals),
+			RefType:   refType,
+		},
+	}
+	if token != nil {
+		data, err := controller.PackERC20Transfer(address, amount)
+		if err != nil {
+			alert.TopUpError = err.Error()
+			return
+		}
+		req.To = common.HexToAddress(token.Address)
+		req.Value = nil
+		req.Data = data
+		req.Record.Contract = param.CONTRACT_ERC20
+	}
+	sent, err := monitor.Service.Send(req)
+	if err != nil {
+		alert.TopUpError = controller.ToAPIError(err).Message
+		return
+	}
+	alert.TopUpAmount = controller.FormatAmount(amount, decimals)
+	alert.TopUpHash = sent.Record.Hash
+}
@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/ninjadotorg/handshake-ethereum/param"
+	"google.golang.org/api/option"
+)
+
+// Alert is a balance of an operator account below its threshold
+type Alert struct {
+	Network     string `json:"network"`
+	Address     string `json:"address"`
+	Asset       string `json:"asset"`
+	Balance     string `json:"balance"`
+	Threshold   string `json:"threshold"`
+	TopUpAmount string `json:"top_up_amount,omitempty"`
+	TopUpHash   string `json:"top_up_hash,omitempty"`
+	TopUpError  string `json:"top_up_error,omitempty"`
+}
+
+// Sink delivers the alerts
+type Sink interface {
+	Send(alert Alert) error
+}
+
+// LogSink only logs the alerts
+type LogSink struct {
+}
+
+func (sink LogSink) Send(alert Alert) error {
+	jsonStr, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	log.Println("alert", string(jsonStr))
+	return nil
+}
+
+// PubsubSink publishes the alerts to a pubsub topic
+type PubsubSink struct {
+	Topic *pubsub.Topic
+}
+
+func (sink PubsubSink) Send(alert Alert) error {
+	jsonStr, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	log.Println("alert", string(jsonStr))
+	res := sink.Topic.Publish(context.Background(), &pubsub.Message{Data: jsonStr})
+	_, err = res.Get(context.Background())
+	return err
+}
+
+// NewSink returns the sink of conf, the topic is created when it does not exist
+func NewSink(conf param.AlertsConfig) (Sink, error) {
+	if conf.Topic == "" {
+		return LogSink{}, nil
+	}
+	opt := option.WithCredentialsFile(param.Conf.CredsFile)
+	pubsubClient, err := pubsub.NewClient(context.Background(), param.Conf.ProjectID, opt)
+	if err != nil {
+		return nil, err
+	}
+	pubsubTopic := pubsubClient.Topic(conf.Topic)
+	existed, err := pubsubTopic.Exists(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		pubsubTopic, err = pubsubClient.CreateTopic(context.Background(), conf.Topic)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return PubsubSink{Topic: pubsubTopic}, nil
+}
@@ -5,6 +5,10 @@ import (
 	"log"
 	"math/big"
 	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 var Conf Config
@@ -12,6 +16,7 @@ var Conf Config
 var CONTRACT_PAYABLE = "payable"
 var CONTRACT_CROWDSALE = "crowdsale"
 var CONTRACT_CRYPTOSIGN = "cryptosign"
+var CONTRACT_ERC20 = "erc20"
 var ABI_STRUCTS = map[string]map[string]interface{}{}
 var ABI_FILES = map[string]string{}
 
@@ -33,6 +38,11 @@ func Initialize(confFile string) error {
 	ABI_FILES[CONTRACT_PAYABLE] = "./abi/payable.abi"
 	ABI_FILES[CONTRACT_CROWDSALE] = "./abi/crowdsale.abi"
 	ABI_FILES[CONTRACT_CRYPTOSIGN] = "./abi/cryptosign.abi"
+	ABI_FILES[CONTRACT_ERC20] = "./abi/erc20.abi"
+	// handshake variants deployed after this build are registered by config
+	for contract, file := range conf.Abis {
+		ABI_FILES[contract] = file
+	}
 
 	ABI_STRUCTS[CONTRACT_PAYABLE] = map[string]interface{}{}
 	ABI_STRUCTS[CONTRACT_CROWDSALE] = map[string]interface{}{}
@@ -93,17 +103,21 @@ func Initialize(confFile string) error {
 	}
 	ABI_STRUCTS[CONTRACT_CROWDSALE]["__withdraw"] = struct {
 		Hid      *big.Int `json:"hid"`
-		State    uint8    `json:"state"`
+		Amount   *big.Int `json:"amount"`
 		Offchain [32]byte `json:"offchain"`
 	}{big.NewInt(1),
-		1,
+		big.NewInt(1),
 		[32]byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
 	}
 	//payable conf
 	ABI_STRUCTS[CONTRACT_PAYABLE]["__init"] = struct {
-		Hid      *big.Int `json:"hid"`
-		Offchain [32]byte `json:"offchain"`
+		Hid      *big.Int       `json:"hid"`
+		Payee    common.Address `json:"payee"`
+		Payer    common.Address `json:"payer"`
+		Offchain [32]byte       `json:"offchain"`
 	}{big.NewInt(1),
+		common.Address{},
+		common.Address{},
 		[32]byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
 	}
 	ABI_STRUCTS[CONTRACT_PAYABLE]["__shake"] = struct {
@@ -147,26 +161,246 @@ func Initialize(confFile string) error {
 }
 
 type Network struct {
-	NetworkURL   string `json:"network_url"`
-	PrivateKey   string `json:"private_key"`
-	TokenAddress string `json:"token_address"`
+	NetworkURL   string            `json:"network_url"`
+	PrivateKey   string            `json:"private_key"`
+	TokenAddress string            `json:"token_address"`
+	Tokens       map[string]Token  `json:"tokens"`
+	Contracts    map[string]string `json:"contracts"`
+	Faucet       FaucetLimits      `json:"faucet"`
+	Handshake    HandshakeLimits   `json:"handshake"`
+	// AllowedUsers and RequiredScope restrict who can use the network, e.g. mainnet
+	AllowedUsers  []int64 `json:"allowed_users"`
+	RequiredScope string  `json:"required_scope"`
+	// RequireRegisteredSender only accepts POST /tx for transactions sent from a wallet of the user
+	RequireRegisteredSender bool `json:"require_registered_sender"`
+	// ChainID is read from the node when it is 0
+	ChainID   int64           `json:"chain_id"`
+	Relay     RelayLimits     `json:"relay"`
+	MetaTx    MetaTxConfig    `json:"meta_tx"`
+	Operators OperatorsConfig `json:"operators"`
+	// HDBasePath overrides the base path of the deposit addresses of the network
+	HDBasePath string          `json:"hd_base_path"`
+	Deposits   DepositsConfig  `json:"deposits"`
+	TokenLogs  TokenLogsConfig `json:"token_logs"`
+}
+
+// TokenLogsConfig indexes the Transfer and Approval logs of the tokens of a network like the handshake contracts
+type TokenLogsConfig struct {
+	Enabled   bool   `json:"enabled"`
+	TopicName string `json:"topic_name"`
+	// MaxBlocks scanned per run, 5000 when it is 0
+	MaxBlocks int64 `json:"max_blocks"`
+}
+
+// DepositsConfig is the scanner of the deposits to the watched addresses of a network
+type DepositsConfig struct {
+	Enabled bool `json:"enabled"`
+	// Confirmations before a deposit is confirmed, 12 when it is 0
+	Confirmations int64 `json:"confirmations"`
+	// StartBlock is the first block scanned, the scan starts at the last confirmed block when it is 0
+	StartBlock int64 `json:"start_block"`
+	// MaxBlocks scanned per run, 100 when it is 0
+	MaxBlocks int64  `json:"max_blocks"`
+	TopicName string `json:"topic_name"`
+}
+
+// OperatorsConfig is the balance monitoring of the operator accounts of a network, the key of the
+// network and the meta tx relayer are always monitored
+type OperatorsConfig struct {
+	Addresses []string `json:"addresses"`
+	// MinEther and MinTokens, keyed by token symbol, are the alert thresholds, 0 is no alert
+	MinEther  float64            `json:"min_ether"`
+	MinTokens map[string]float64 `json:"min_tokens"`
+	Treasury  TreasuryConfig     `json:"treasury"`
+}
+
+// TreasuryConfig tops up the operator accounts below the thresholds, an empty private key disables it
+type TreasuryConfig struct {
+	PrivateKey string `json:"private_key"`
+	// TargetEther and TargetTokens are the balances the accounts are topped up to
+	TargetEther  float64            `json:"target_ether"`
+	TargetTokens map[string]float64 `json:"target_tokens"`
+	// DailyEther and DailyTokens cap the amounts sent by the treasury in 24 hours, 0 is no top-up
+	DailyEther  float64            `json:"daily_ether"`
+	DailyTokens map[string]float64 `json:"daily_tokens"`
+	// Cooldown is the time in seconds before an account is topped up again, 600 when it is 0
+	Cooldown int64 `json:"cooldown"`
+}
+
+// RelayLimits are the checks of the signed transactions relayed by POST /tx/raw,
+// 0 or an empty list is no limit
+type RelayLimits struct {
+	// MaxGasPrice is in gwei
+	MaxGasPrice float64 `json:"max_gas_price"`
+	// MaxFee is gas * gas price in ether
+	MaxFee            float64  `json:"max_fee"`
+	AllowedRecipients []string `json:"allowed_recipients"`
+}
+
+// MetaTxConfig is the relayer of the EIP-712 signed handshake intents of POST /meta-tx
+type MetaTxConfig struct {
+	// PrivateKey of the relayer, it must not be the key of the network
+	PrivateKey string `json:"private_key"`
+	// Forwarder is the address of the forwarder contract the intents are relayed through, nothing is relayed without it
+	Forwarder     string `json:"forwarder"`
+	DomainName    string `json:"domain_name"`
+	DomainVersion string `json:"domain_version"`
+	// Contracts the intents may call, payable and crowdsale when it is empty
+	Contracts []string `json:"contracts"`
+	// DailyGasQuota is the gas relayed per user in 24 hours, 0 disables the relayer
+	DailyGasQuota uint64 `json:"daily_gas_quota"`
+}
+
+type Token struct {
+	Symbol   string `json:"-"`
+	Address  string `json:"address"`
+	Decimals int    `json:"decimals"`
+	// StartBlock is the first block scanned for the logs of the token, e.g. its deployment block,
+	// the first scan starts at the head when it is 0
+	StartBlock int64 `json:"start_block"`
+}
+
+// GetToken looks up a token by symbol, an empty symbol is the network's default token
+func (network Network) GetToken(symbol string) (Token, bool) {
+	if symbol == "" {
+		if network.TokenAddress == "" {
+			return Token{}, false
+		}
+		return Token{Address: network.TokenAddress, Decimals: 18}, true
+	}
+	token, ok := network.Tokens[symbol]
+	if !ok {
+		return Token{}, false
+	}
+	token.Symbol = symbol
+	return token, true
+}
+
+// GetTokens lists the registered tokens followed by the default token when it is not registered
+func (network Network) GetTokens() []Token {
+	tokens := []Token{}
+	hasDefault := network.TokenAddress == ""
+	for symbol, token := range network.Tokens {
+		token.Symbol = symbol
+		tokens = append(tokens, token)
+		if strings.EqualFold(token.Address, network.TokenAddress) {
+			hasDefault = true
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Symbol < tokens[j].Symbol
+	})
+	if !hasDefault {
+		token, _ := network.GetToken("")
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// FaucetLimits holds the limits of /free-ether and /free-token for a network
+type FaucetLimits struct {
+	Ether FaucetLimit `json:"ether"`
+	// Token applies to each token separately, its amounts are in the units of the token
+	Token FaucetLimit `json:"token"`
+}
+
+// HandshakeLimits bound the ether the key of the network attaches to the payable and crowdsale calls of a user,
+// no ether is attached for the users when DailyValue is 0
+type HandshakeLimits struct {
+	// MaxValue is the ether of a call, 0 is no limit
+	MaxValue   float64 `json:"max_value"`
+	DailyValue float64 `json:"daily_value"`
+}
+
+// FaucetLimit values of 0 mean unlimited, cooldowns are in seconds
+type FaucetLimit struct {
+	MaxAmount       float64 `json:"max_amount"`
+	UserCooldown    int64   `json:"user_cooldown"`
+	AddressCooldown int64   `json:"address_cooldown"`
+	DailyRequests   int64   `json:"daily_requests"`
+	DailyAmount     float64 `json:"daily_amount"`
 }
 
 type Config struct {
-	DbURL     string `json:"db_url"`
-	CredsFile string `json:"creds_file"`
-	ProjectID string `json:"project_id"`
-	Agrs      []Agr  `json:"agrs"`
+	DbURL                string              `json:"db_url"`
+	CredsFile            string              `json:"creds_file"`
+	ProjectID            string              `json:"project_id"`
+	Agrs                 []Agr               `json:"agrs"`
+	BalanceCacheTTL      int64               `json:"balance_cache_ttl"`
+	Abis                 map[string]string   `json:"abis"`
+	IdempotencyRetention int64               `json:"idempotency_retention"`
+	Auth                 AuthConfig          `json:"auth"`
+	Authorization        AuthorizationConfig `json:"authorization"`
+	LegacyErrors         bool                `json:"legacy_errors"`
+	Alerts               AlertsConfig        `json:"alerts"`
+	HDWallet             HDWalletConfig      `json:"hd_wallet"`
 	// RinkebyNetwork      string             `json:"rinkeby_network"`
 	// RinkebyPrivateKey   string             `json:"rinkeby_private_key"`
 	// RinkebyTokenAddress string             `json:"rinkeby_token_address"`
 	Networks map[string]Network `json:"networks"`
 }
 
+// AuthConfig enables the authenticators of the service, a request is accepted by the first one it has credentials for,
+// an hmac block without secret, a jwt block without secret and jwks file and an api key without key are disabled
+type AuthConfig struct {
+	HMAC    *HMACAuthConfig `json:"hmac"`
+	JWT     *JWTAuthConfig  `json:"jwt"`
+	APIKeys []APIKeyConfig  `json:"api_keys"`
+}
+
+// HMACAuthConfig verifies requests signed by our gateway, MaxSkew is in seconds
+type HMACAuthConfig struct {
+	Secret  string   `json:"secret"`
+	MaxSkew int64    `json:"max_skew"`
+	Scopes  []string `json:"scopes"`
+}
+
+type JWTAuthConfig struct {
+	Issuer    string `json:"issuer"`
+	Audience  string `json:"audience"`
+	Secret    string `json:"secret"`
+	JWKSFile  string `json:"jwks_file"`
+	UserClaim string `json:"user_claim"`
+}
+
+type APIKeyConfig struct {
+	Name   string   `json:"name"`
+	Key    string   `json:"key"`
+	UserID int64    `json:"user_id"`
+	Scopes []string `json:"scopes"`
+}
+
+// AuthorizationConfig overrides the scopes required by routes, keyed like "POST /free-ether"
+type AuthorizationConfig struct {
+	AdminScope  string              `json:"admin_scope"`
+	AdminRoutes []string            `json:"admin_routes"`
+	RouteScopes map[string][]string `json:"route_scopes"`
+}
+
+// HDWalletConfig is the HD wallet of the deposit addresses, its seed is the key of an encrypted keystore file
+type HDWalletConfig struct {
+	KeystoreFile string `json:"keystore_file"`
+	// PassphraseEnv is the environment variable holding the passphrase of the keystore, HD_WALLET_PASSPHRASE when it is empty
+	PassphraseEnv string `json:"passphrase_env"`
+	// BasePath is the derivation path the id of the user is appended to, m/44'/60'/0'/0 when it is empty
+	BasePath string `json:"base_path"`
+}
+
+// AlertsConfig is the sink of the alerts of the worker, alerts are only logged when Topic is empty
+type AlertsConfig struct {
+	Topic string `json:"topic"`
+	// Interval is the time in seconds before the same alert is sent again, 3600 when it is 0
+	Interval int64 `json:"interval"`
+}
+
 type Agr struct {
 	ChainID         int    `json:"chain_id"`
 	ChainNetwork    string `json:"chain_network"`
 	Contract        string `json:"contract"`
 	ContractAddress string `json:"contract_address"`
 	TopicName       string `json:"topic_name"`
+	// StartBlock is the first block scanned before a log is indexed, the scan starts at the genesis when it is 0
+	StartBlock int64 `json:"start_block"`
+	// MaxBlocks scanned per run, the whole range up to the head is scanned when it is 0
+	MaxBlocks int64 `json:"max_blocks"`
 }
@@ -0,0 +1,128 @@
+package txservice
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ErrBatchStopped is the error of the items of a batch which were not broadcast because an earlier item failed
+var ErrBatchStopped = errors.New("not sent, an earlier transfer of the batch failed")
+
+// BatchResult is the result of the request at the same position of a batch
+type BatchResult struct {
+	Result
+	Err error
+}
+
+// BatchError rejects a whole batch because one of its items can not be sent, nothing was broadcast
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (err *BatchError) Error() string {
+	return fmt.Sprintf("item %d: %s", err.Index, err.Err)
+}
+
+// SendBatch sends requests signed by the same key with sequential nonces. Every item is simulated and priced,
+// at most concurrency of them at a time, before the nonces are reserved and the items are signed, the batch is
+// rejected with a BatchError when one of them fails. persist stores the signed items before they are broadcast
+// in nonce order, the items after a broadcast failure are not sent and their nonces are released.
+// The requests of a dry run are priced with the nonces they would have.
+func (service *Service) SendBatch(requests []Request, concurrency int, persist func([]BatchResult) error) ([]BatchResult, error) {
+	results := make([]BatchResult, len(requests))
+	if len(requests) == 0 {
+		return results, nil
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	privateKey, err := service.key(requests[0])
+	if err != nil {
+		return results, err
+	}
+	from := crypto.PubkeyToAddress(privateKey.PublicKey)
+	dryRun := requests[0].DryRun
+
+	errs := make([]error, len(requests))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range requests {
+		req := requests[i]
+		req.DryRun = true
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, req Request) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i].Result, errs[i] = service.prepare(from, 0, req)
+		}(i, req)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return results, &BatchError{Index: i, Err: err}
+		}
+	}
+
+	var nonce uint64
+	if dryRun {
+		nonce, err = service.build(from, true)
+	} else {
+		nonce, err = service.reserveNonces(from, uint64(len(requests)))
+	}
+	if err != nil {
+		return results, err
+	}
+	for i := range results {
+		priced := results[i].Transaction
+		tx := types.NewTransaction(nonce+uint64(i), *priced.To(), priced.Value(), priced.Gas(), priced.GasPrice(), priced.Data())
+		results[i].Transaction = tx
+		results[i].Record = service.record(from, tx, requests[i].Record)
+		if dryRun {
+			continue
+		}
+		results[i].Result, err = service.sign(results[i].Result, privateKey)
+		if err != nil {
+			service.releaseNonces(from, nonce, len(results))
+			return results, &BatchError{Index: i, Err: err}
+		}
+	}
+	if dryRun {
+		return results, nil
+	}
+	if persist != nil {
+		err = persist(results)
+		if err != nil {
+			service.releaseNonces(from, nonce, len(results))
+			return results, err
+		}
+	}
+
+	for i := range results {
+		results[i].Err = service.broadcast(&results[i].Result)
+		if results[i].Record.Hash != "" {
+			service.done(from)
+			continue
+		}
+		// the later nonces can not be mined without this one
+		service.releaseNonces(from, nonce+uint64(i), len(results)-i)
+		for j := i + 1; j < len(results); j++ {
+			results[j].Err = ErrBatchStopped
+		}
+		break
+	}
+	return results, nil
+}
+
+// releaseNonces releases count nonces from nonce, the highest first so they are rolled back
+func (service *Service) releaseNonces(from common.Address, nonce uint64, count int) {
+	for i := count - 1; i >= 0; i-- {
+		service.release(from, nonce+uint64(i))
+	}
+}
@@ -0,0 +1,226 @@
+package txservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSendBatch(t *testing.T) {
+	service, backend, privateKey, records := newTestService(t)
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	requests := []Request{}
+	for i := 0; i < 3; i++ {
+		requests = append(requests, transferRequest(privateKey, to, 1000))
+	}
+	results, err := service.SendBatch(requests, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			t.Fatalf("item %d: %v", i, result.Err)
+		}
+		if result.Transaction.Nonce() != uint64(i) {
+			t.Errorf("item %d: nonce %d", i, result.Transaction.Nonce())
+		}
+		if result.Record.Hash == "" {
+			t.Errorf("item %d is not broadcast", i)
+		}
+	}
+	if len(*records) != 3 {
+		t.Errorf("%d transactions are recorded, want 3", len(*records))
+	}
+	backend.Commit()
+	balance, err := backend.BalanceAt(context.Background(), to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != 3000 {
+		t.Errorf("balance %s, want 3000", balance)
+	}
+
+	// the next send continues after the batch
+	result, err := service.Send(transferRequest(privateKey, to, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transaction.Nonce() != 3 {
+		t.Errorf("nonce %d, want 3", result.Transaction.Nonce())
+	}
+}
+
+func TestSendBatchDryRun(t *testing.T) {
+	service, _, privateKey, records := newTestService(t)
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	requests := []Request{}
+	for i := 0; i < 2; i++ {
+		req := transferRequest(privateKey, to, 1000)
+		req.DryRun = true
+		requests = append(requests, req)
+	}
+	results, err := service.SendBatch(requests, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			t.Fatalf("item %d: %v", i, result.Err)
+		}
+		if result.Transaction.Nonce() != uint64(i) || result.EstimatedGas != 21000 {
+			t.Errorf("item %d: nonce %d, estimated gas %d", i, result.Transaction.Nonce(), result.EstimatedGas)
+		}
+	}
+	if len(*records) != 0 {
+		t.Error("dry run transactions are recorded")
+	}
+
+	result, err := service.Send(transferRequest(privateKey, to, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transaction.Nonce() != 0 {
+		t.Errorf("nonce %d, want 0", result.Transaction.Nonce())
+	}
+}
+
+func TestSendBatchReleasesNonce(t *testing.T) {
+	service, backend, privateKey, _ := newTestService(t)
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	backend.reject(1)
+	requests := []Request{}
+	for i := 0; i < 2; i++ {
+		requests = append(requests, transferRequest(privateKey, to, 1000))
+	}
+	results, err := service.SendBatch(requests, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[1].Err != errRejected {
+		t.Fatalf("errors %v and %v", results[0].Err, results[1].Err)
+	}
+
+	result, err := service.Send(transferRequest(privateKey, to, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transaction.Nonce() != 1 {
+		t.Errorf("nonce %d, want the released nonce 1", result.Transaction.Nonce())
+	}
+}
+
+func TestSendBatchStopsOnBroadcastFailure(t *testing.T) {
+	service, backend, privateKey, records := newTestService(t)
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	backend.reject(0)
+	requests := []Request{}
+	for i := 0; i < 3; i++ {
+		requests = append(requests, transferRequest(privateKey, to, 1000))
+	}
+	results, err := service.SendBatch(requests, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != errRejected || results[1].Err != ErrBatchStopped || results[2].Err != ErrBatchStopped {
+		t.Fatalf("errors %v, %v and %v", results[0].Err, results[1].Err, results[2].Err)
+	}
+	for i, result := range results {
+		if result.Record.Hash != "" {
+			t.Errorf("item %d is broadcast", i)
+		}
+	}
+	if len(*records) != 0 {
+		t.Error("transactions are recorded")
+	}
+
+	result, err := service.Send(transferRequest(privateKey, to, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transaction.Nonce() != 0 {
+		t.Errorf("nonce %d, want the released nonce 0", result.Transaction.Nonce())
+	}
+}
+
+func TestSendBatchRejectsUnpricedItem(t *testing.T) {
+	service, backend, privateKey, _ := newTestService(t)
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	errReverted := errors.New("transaction reverts")
+	service.Simulate = func(backend Backend, msg ethereum.CallMsg) (uint64, error) {
+		if msg.Value.Int64() == 2000 {
+			return 0, errReverted
+		}
+		return backend.EstimateGas(context.Background(), msg)
+	}
+	requests := []Request{
+		transferRequest(privateKey, to, 1000),
+		transferRequest(privateKey, to, 2000),
+	}
+	persisted := false
+	_, err := service.SendBatch(requests, 2, func([]BatchResult) error {
+		persisted = true
+		return nil
+	})
+	batchErr, ok := err.(*BatchError)
+	if !ok || batchErr.Index != 1 || batchErr.Err != errReverted {
+		t.Fatalf("error %v, want a BatchError of item 1", err)
+	}
+	if persisted {
+		t.Error("rejected batch is persisted")
+	}
+	nonce, err := backend.PendingNonceAt(context.Background(), crypto.PubkeyToAddress(privateKey.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 0 {
+		t.Errorf("%d transactions are broadcast", nonce)
+	}
+}
+
+func TestSendBatchPersistsBeforeBroadcast(t *testing.T) {
+	service, backend, privateKey, _ := newTestService(t)
+	from := crypto.PubkeyToAddress(privateKey.PublicKey)
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	requests := []Request{
+		transferRequest(privateKey, to, 1000),
+		transferRequest(privateKey, to, 1000),
+	}
+	errPersist := errors.New("batch is not stored")
+	_, err := service.SendBatch(requests, 1, func(results []BatchResult) error {
+		nonce, err := backend.PendingNonceAt(context.Background(), from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonce != 0 {
+			t.Errorf("%d transactions are broadcast before the batch is persisted", nonce)
+		}
+		for i, result := range results {
+			if result.Transaction.Nonce() != uint64(i) {
+				t.Errorf("item %d: nonce %d", i, result.Transaction.Nonce())
+			}
+		}
+		return errPersist
+	})
+	if err != errPersist {
+		t.Fatalf("error %v, want %v", err, errPersist)
+	}
+
+	// the nonces of the batch are released
+	result, err := service.Send(transferRequest(privateKey, to, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transaction.Nonce() != 0 {
+		t.Errorf("nonce %d, want 0", result.Transaction.Nonce())
+	}
+}
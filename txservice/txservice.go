@@ -0,0 +1,371 @@
+package txservice
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+// Backend is the part of an ethereum client used to send transactions,
+// it is implemented by ethclient.Client and by backends.SimulatedBackend
+type Backend interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	PendingCallContract(ctx context.Context, call ethereum.CallMsg) ([]byte, error)
+	EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// Recorder stores a broadcast transaction
+type Recorder func(models.EthereumTransactions) (models.EthereumTransactions, error)
+
+// Simulator runs a call against the pending state and returns its estimated gas
+type Simulator func(backend Backend, msg ethereum.CallMsg) (uint64, error)
+
+// Request describes a transaction to send, Record holds the fields of the ethereum_transactions row
+// known by the caller (RefType, RefID, UserID, Contract, Value and optionally ToAddress)
+type Request struct {
+	// PrivateKey signs the transaction, the key of From is read from the Keys of the service when it is nil
+	PrivateKey *ecdsa.PrivateKey
+	From       common.Address
+	To         common.Address
+	Value      *big.Int
+	Data       []byte
+	// GasLimit is estimated when it is 0
+	GasLimit uint64
+	// GasPriceBump is added to the suggested gas price
+	GasPriceBump *big.Int
+	// Nonce is used instead of the next nonce of the signer when it is set, it is not tracked by the service
+	Nonce  *uint64
+	DryRun bool
+	Record models.EthereumTransactions
+}
+
+// KeySource returns the keys of the addresses the service signs for, e.g. the deposit addresses of an HD wallet
+type KeySource interface {
+	PrivateKey(address common.Address) (*ecdsa.PrivateKey, error)
+}
+
+// KeyError is returned for a request without private key when the service has no key of its address
+type KeyError struct {
+	Address common.Address
+}
+
+func (err *KeyError) Error() string {
+	return "no key can sign for " + err.Address.Hex()
+}
+
+// Result is the sent transaction, it is not signed for a dry run
+type Result struct {
+	From         common.Address
+	Transaction  *types.Transaction
+	EstimatedGas uint64
+	Record       models.EthereumTransactions
+}
+
+// Service sends the transactions of a network: build -> price -> sign -> broadcast -> record
+type Service struct {
+	Network string
+	Backend Backend
+	Signer  types.Signer
+	// Recorder stores the broadcast transactions, they are not stored when it is nil
+	Recorder Recorder
+	// Simulate estimates the gas of the transactions, Backend.EstimateGas is used when it is nil
+	Simulate Simulator
+	// Keys signs the requests without a private key, it is nil when the network has no HD wallet
+	Keys KeySource
+
+	mutex    sync.Mutex
+	accounts map[common.Address]*account
+}
+
+// account tracks the nonces handed out for an address
+type account struct {
+	// next is the nonce after the highest one handed out
+	next uint64
+	// inflight counts the nonces handed out which were neither broadcast nor released yet
+	inflight int
+	// released are nonces below next whose transaction was not broadcast, they are handed out again first
+	released []uint64
+}
+
+func New(network string, backend Backend) *Service {
+	return &Service{
+		Network:  network,
+		Backend:  backend,
+		Signer:   types.HomesteadSigner{},
+		accounts: map[common.Address]*account{},
+	}
+}
+
+// Send runs the pipeline for req, a dry run stops after pricing and returns the unsigned transaction
+func (service *Service) Send(req Request) (Result, error) {
+	result := Result{From: req.From}
+	privateKey, err := service.key(req)
+	if err != nil {
+		return result, err
+	}
+	req.PrivateKey = privateKey
+	result.From = crypto.PubkeyToAddress(req.PrivateKey.PublicKey)
+
+	// a nonce set by the caller is not tracked, the caller owns it
+	tracked := req.Nonce == nil && !req.DryRun
+	var nonce uint64
+	if req.Nonce != nil {
+		nonce = *req.Nonce
+	} else {
+		nonce, err = service.build(result.From, req.DryRun)
+		if err != nil {
+			return result, err
+		}
+	}
+	result, err = service.prepare(result.From, nonce, req)
+	if err != nil || req.DryRun {
+		if tracked {
+			service.release(result.From, nonce)
+		}
+		return result, err
+	}
+	result, err = service.sign(result, req.PrivateKey)
+	if err != nil {
+		if tracked {
+			service.release(result.From, nonce)
+		}
+		return result, err
+	}
+	err = service.broadcast(&result)
+	if tracked {
+		if result.Record.Hash == "" {
+			service.release(result.From, nonce)
+		} else {
+			service.done(result.From)
+		}
+	}
+	return result, err
+}
+
+// key returns the private key signing req
+func (service *Service) key(req Request) (*ecdsa.PrivateKey, error) {
+	if req.PrivateKey != nil {
+		return req.PrivateKey, nil
+	}
+	if service.Keys == nil {
+		return nil, &KeyError{Address: req.From}
+	}
+	return service.Keys.PrivateKey(req.From)
+}
+
+// prepare prices the transaction of req with nonce and fills its ethereum_transactions row
+func (service *Service) prepare(from common.Address, nonce uint64, req Request) (Result, error) {
+	result := Result{From: from}
+	if req.Value == nil {
+		req.Value = big.NewInt(0)
+	}
+	gasLimit, gasPrice, estimatedGas, err := service.price(from, req)
+	if err != nil {
+		return result, err
+	}
+	result.EstimatedGas = estimatedGas
+	result.Transaction = types.NewTransaction(nonce, req.To, req.Value, gasLimit, gasPrice, req.Data)
+	result.Record = service.record(from, result.Transaction, req.Record)
+	return result, nil
+}
+
+// sign replaces the transaction of result by its signed copy
+func (service *Service) sign(result Result, privateKey *ecdsa.PrivateKey) (Result, error) {
+	signedTx, err := types.SignTx(result.Transaction, service.Signer, privateKey)
+	if err != nil {
+		return result, err
+	}
+	result.Transaction = signedTx
+	return result, nil
+}
+
+// broadcast sends the signed transaction of result and records it, the hash of the record is only set
+// once the node has accepted the transaction, even when recording it fails
+func (service *Service) broadcast(result *Result) error {
+	err := service.Backend.SendTransaction(context.Background(), result.Transaction)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s hash : %s", service.Network, result.Transaction.Hash().Hex())
+
+	result.Record.Hash = result.Transaction.Hash().Hex()
+	if service.Recorder == nil {
+		return nil
+	}
+	record, err := service.Recorder(result.Record)
+	if err != nil {
+		return err
+	}
+	result.Record = record
+	return nil
+}
+
+// build returns the nonce of the next transaction of from. The nonces handed out are tracked so concurrent
+// sends do not reuse a nonce the node has not seen yet, the tracking is resynced to the pending nonce of the
+// node when no nonce is in flight.
+func (service *Service) build(from common.Address, dryRun bool) (uint64, error) {
+	pendingNonce, err := service.Backend.PendingNonceAt(context.Background(), from)
+	if err != nil {
+		return 0, err
+	}
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	account := service.account(from, pendingNonce)
+	if dryRun {
+		if len(account.released) > 0 {
+			return account.released[0], nil
+		}
+		return account.next, nil
+	}
+	account.inflight++
+	if len(account.released) > 0 {
+		nonce := account.released[0]
+		account.released = account.released[1:]
+		return nonce, nil
+	}
+	account.next++
+	return account.next - 1, nil
+}
+
+// reserveNonces hands out count sequential nonces of from and returns the first one,
+// every nonce must be given back with done or release
+func (service *Service) reserveNonces(from common.Address, count uint64) (uint64, error) {
+	pendingNonce, err := service.Backend.PendingNonceAt(context.Background(), from)
+	if err != nil {
+		return 0, err
+	}
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	account := service.account(from, pendingNonce)
+	nonce := account.next
+	account.next += count
+	account.inflight += int(count)
+	return nonce, nil
+}
+
+// account returns the tracking of from, it must be called with the mutex locked
+func (service *Service) account(from common.Address, pendingNonce uint64) *account {
+	tracked, ok := service.accounts[from]
+	if !ok {
+		tracked = &account{next: pendingNonce}
+		service.accounts[from] = tracked
+	}
+	if tracked.inflight == 0 {
+		// nothing is in flight, the node knows every transaction which was broadcast
+		tracked.next = pendingNonce
+		tracked.released = nil
+		return tracked
+	}
+	if tracked.next < pendingNonce {
+		tracked.next = pendingNonce
+	}
+	// the released nonces used by transactions sent elsewhere are dropped
+	released := []uint64{}
+	for _, nonce := range tracked.released {
+		if nonce >= pendingNonce {
+			released = append(released, nonce)
+		}
+	}
+	tracked.released = released
+	return tracked
+}
+
+// done marks a nonce handed out for from as broadcast
+func (service *Service) done(from common.Address) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if tracked, ok := service.accounts[from]; ok && tracked.inflight > 0 {
+		tracked.inflight--
+	}
+}
+
+// release gives back a nonce whose transaction was not broadcast, the highest nonce is rolled back and
+// the other ones are handed out again before next so no gap is left
+func (service *Service) release(from common.Address, nonce uint64) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	tracked, ok := service.accounts[from]
+	if !ok {
+		return
+	}
+	if tracked.inflight > 0 {
+		tracked.inflight--
+	}
+	if nonce >= tracked.next {
+		return
+	}
+	tracked.released = append(tracked.released, nonce)
+	sort.Slice(tracked.released, func(i, j int) bool {
+		return tracked.released[i] < tracked.released[j]
+	})
+	// roll back the highest nonces
+	for len(tracked.released) > 0 && tracked.released[len(tracked.released)-1] == tracked.next-1 {
+		tracked.released = tracked.released[:len(tracked.released)-1]
+		tracked.next--
+	}
+}
+
+// price returns the gas limit and gas price of the transaction, the transaction is simulated
+// when the gas limit must be estimated and for dry runs
+func (service *Service) price(from common.Address, req Request) (uint64, *big.Int, uint64, error) {
+	gasPrice, err := service.Backend.SuggestGasPrice(context.Background())
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if req.GasPriceBump != nil {
+		gasPrice = new(big.Int).Add(gasPrice, req.GasPriceBump)
+	}
+	gasLimit := req.GasLimit
+	estimatedGas := uint64(0)
+	if gasLimit == 0 || req.DryRun {
+		to := req.To
+		estimatedGas, err = service.simulate(ethereum.CallMsg{
+			From:  from,
+			To:    &to,
+			Value: req.Value,
+			Data:  req.Data,
+		})
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		if gasLimit == 0 {
+			gasLimit = estimatedGas
+		}
+	}
+	return gasLimit, gasPrice, estimatedGas, nil
+}
+
+func (service *Service) simulate(msg ethereum.CallMsg) (uint64, error) {
+	if service.Simulate != nil {
+		return service.Simulate(service.Backend, msg)
+	}
+	return service.Backend.EstimateGas(context.Background(), msg)
+}
+
+// record fills the ethereum_transactions row of the transaction
+func (service *Service) record(from common.Address, tx *types.Transaction, ethTrans models.EthereumTransactions) models.EthereumTransactions {
+	ethTrans.Network = service.Network
+	ethTrans.FromAddress = from.Hex()
+	if ethTrans.ToAddress == "" {
+		ethTrans.ToAddress = tx.To().Hex()
+	}
+	ethTrans.Nonce = int(tx.Nonce())
+	ethTrans.Gas = float64(tx.Gas())
+	ethTrans.GasPrice, _ = new(big.Float).SetInt(tx.GasPrice()).Float64()
+	if len(tx.Data()) > 0 {
+		ethTrans.Data = hexutil.Encode(tx.Data())
+	}
+	return ethTrans
+}
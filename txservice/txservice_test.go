@@ -0,0 +1,215 @@
+package txservice
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ninjadotorg/handshake-ethereum/models"
+)
+
+var errRejected = errors.New("transaction is rejected")
+
+// testBackend rejects the transactions of the nonces in rejected instead of sending them to the simulated chain
+type testBackend struct {
+	*backends.SimulatedBackend
+	mutex    sync.Mutex
+	rejected map[uint64]bool
+}
+
+func (backend *testBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	backend.mutex.Lock()
+	rejected := backend.rejected[tx.Nonce()]
+	delete(backend.rejected, tx.Nonce())
+	backend.mutex.Unlock()
+	if rejected {
+		return errRejected
+	}
+	return backend.SimulatedBackend.SendTransaction(ctx, tx)
+}
+
+func (backend *testBackend) reject(nonce uint64) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	backend.rejected[nonce] = true
+}
+
+func newTestService(t *testing.T) (*Service, *testBackend, *ecdsa.PrivateKey, *[]models.EthereumTransactions) {
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &testBackend{
+		SimulatedBackend: backends.NewSimulatedBackend(core.GenesisAlloc{
+			crypto.PubkeyToAddress(privateKey.PublicKey): {Balance: big.NewInt(1000000000000000000)},
+		}),
+		rejected: map[uint64]bool{},
+	}
+	records := []models.EthereumTransactions{}
+	service := New("test", backend)
+	service.Recorder = func(ethTrans models.EthereumTransactions) (models.EthereumTransactions, error) {
+		records = append(records, ethTrans)
+		return ethTrans, nil
+	}
+	return service, backend, privateKey, &records
+}
+
+func transferRequest(privateKey *ecdsa.PrivateKey, to common.Address, value int64) Request {
+	return Request{
+		PrivateKey: privateKey,
+		To:         to,
+		Value:      big.NewInt(value),
+		Record: models.EthereumTransactions{
+			RefType: "test_transfer",
+		},
+	}
+}
+
+func TestSend(t *testing.T) {
+	service, backend, privateKey, records := newTestService(t)
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	for i := 0; i < 2; i++ {
+		result, err := service.Send(transferRequest(privateKey, to, 1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Transaction.Nonce() != uint64(i) {
+			t.Errorf("nonce %d, want %d", result.Transaction.Nonce(), i)
+		}
+		if result.Transaction.Gas() != 21000 {
+			t.Errorf("gas %d, want 21000", result.Transaction.Gas())
+		}
+		if result.Record.Hash != result.Transaction.Hash().Hex() {
+			t.Errorf("record hash %s, want %s", result.Record.Hash, result.Transaction.Hash().Hex())
+		}
+		if result.Record.FromAddress != crypto.PubkeyToAddress(privateKey.PublicKey).Hex() || result.Record.RefType != "test_transfer" {
+			t.Errorf("record is not filled: %+v", result.Record)
+		}
+	}
+	if len(*records) != 2 {
+		t.Fatalf("%d transactions are recorded, want 2", len(*records))
+	}
+	backend.Commit()
+	balance, err := backend.BalanceAt(context.Background(), to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != 2000 {
+		t.Errorf("balance %s, want 2000", balance)
+	}
+}
+
+func TestSendDryRun(t *testing.T) {
+	service, _, privateKey, records := newTestService(t)
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	req := transferRequest(privateKey, to, 1000)
+	req.DryRun = true
+	result, err := service.Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.EstimatedGas != 21000 {
+		t.Errorf("estimated gas %d, want 21000", result.EstimatedGas)
+	}
+	if v, _, _ := result.Transaction.RawSignatureValues(); v.Sign() != 0 {
+		t.Error("dry run transaction is signed")
+	}
+	if result.Record.Hash != "" || len(*records) != 0 {
+		t.Error("dry run transaction is recorded")
+	}
+
+	// the dry run does not use the nonce
+	result, err = service.Send(transferRequest(privateKey, to, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transaction.Nonce() != 0 {
+		t.Errorf("nonce %d, want 0", result.Transaction.Nonce())
+	}
+}
+
+func TestSendReleasesNonce(t *testing.T) {
+	service, backend, privateKey, records := newTestService(t)
+	to := common.HexToAddress("0x1000000000000000000000000000000000000001")
+
+	backend.reject(0)
+	result, err := service.Send(transferRequest(privateKey, to, 1000))
+	if err != errRejected {
+		t.Fatalf("error %v, want %v", err, errRejected)
+	}
+	if result.Record.Hash != "" || len(*records) != 0 {
+		t.Error("rejected transaction is recorded")
+	}
+
+	result, err = service.Send(transferRequest(privateKey, to, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transaction.Nonce() != 0 {
+		t.Errorf("nonce %d, want 0", result.Transaction.Nonce())
+	}
+}
+
+func TestReleaseLeavesNoGap(t *testing.T) {
+	service, _, privateKey, _ := newTestService(t)
+	from := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	// two sends are in flight and the first one fails
+	first, err := service.build(from, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := service.build(from, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 0 || second != 1 {
+		t.Fatalf("nonces %d and %d, want 0 and 1", first, second)
+	}
+	service.release(from, first)
+
+	next, err := service.build(from, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 0 {
+		t.Errorf("nonce %d, want the released nonce 0", next)
+	}
+	after, err := service.build(from, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != 2 {
+		t.Errorf("nonce %d, want 2", after)
+	}
+}
+
+func TestBuildResyncsStaleNonce(t *testing.T) {
+	service, _, privateKey, _ := newTestService(t)
+	from := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	// the transaction of nonce 0 was accepted but dropped by the node
+	_, err := service.build(from, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.done(from)
+
+	nonce, err := service.build(from, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 0 {
+		t.Errorf("nonce %d, want the pending nonce 0", nonce)
+	}
+}